@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// ~~~~~~~~~~
+// clipboard
+// ~~~~~~~~~~
+
+// whether programs get to use the clipboard through OSC 52
+type clipPolicy int
+
+const (
+	clipDeny clipPolicy = iota
+	clipAllow
+	clipAsk // ask the user every time
+)
+
+// where the clipboard that programs get at lives
+type clipWhere int
+
+const (
+	clipHost clipWhere = iota // the host terminal's, through OSC 52 of its own
+	clipSystem // the system clipboard, through xclip, xsel, wl-copy or the like
+)
+
+// a clipboard request from a window that's waiting on the user to say y or n
+type pendingClip struct {
+	id  uint
+	req clipReq
+}
+
+// msg for when the system clipboard has been read for a window
+type ClipMsg struct {
+	id   uint
+	sel  string
+	data string
+}
+
+// deal with a window's clipboard request according to clipRead/clipWrite
+func clipRequest (m *model, wid uint, req clipReq) tea.Cmd {
+	pol := clipWrite
+	if req.query {
+		pol = clipRead
+	}
+	switch pol {
+		case clipAllow:
+			return doClip (m, wid, req)
+		case clipAsk:
+			m.clipAsks = append(m.clipAsks, pendingClip { wid, req })
+	}
+	return nil
+}
+
+// answer the oldest clipboard request that's waiting on the user
+func answerClip (m *model, yes bool) tea.Cmd {
+	ca := m.clipAsks[0]
+	m.clipAsks = m.clipAsks[1:]
+	if !yes {
+		return nil
+	}
+	return doClip (m, ca.id, ca.req)
+}
+
+// actually set or read the clipboard for a window. the last thing set is
+// kept in m.clip, that's what a read gets when the clipboard is the host's
+// since there's no good way to ask the host terminal for it
+func doClip (m *model, wid uint, req clipReq) tea.Cmd {
+	primary := strings.ContainsRune(req.sel, 'p') && !strings.ContainsRune(req.sel, 'c')
+	if req.query {
+		if clipTarget == clipHost {
+			clipReply (*m, wid, req.sel, m.clip)
+			return nil
+		}
+		return func() tea.Msg {
+			s, err := clipboard.ReadAll()
+			if err != nil {
+				return nil
+			}
+			return ClipMsg { id: wid, sel: req.sel, data: s }
+		}
+	}
+	m.clip = string(req.data)
+	s := m.clip
+	if clipTarget == clipSystem {
+		return func() tea.Msg {
+			clipboard.WriteAll(s)
+			return nil
+		}
+	}
+	seq := osc52.New(s)
+	if len(req.data) == 0 {
+		seq = osc52.Clear()
+	}
+	if primary {
+		seq = seq.Primary()
+	}
+	switch {
+		case os.Getenv("TMUX") != "":
+			seq = seq.Tmux()
+		case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+			seq = seq.Screen()
+	}
+	return func() tea.Msg {
+		seq.WriteTo(hostOut)
+		return nil
+	}
+}
+
+// send what's on the clipboard back to a window that asked for it
+func clipReply (m model, wid uint, sel, data string) {
+	for _, w := range m.windows {
+		if w.id == wid && !w.exited && w.play == nil {
+			fmt.Fprintf(w.pty, "\x1b]52;%s;%s\x1b\\", sel, base64.StdEncoding.EncodeToString([]byte(data)))
+		}
+	}
+}
+
+// what the prompt for a clipboard request says
+func clipPrompt (m model) string {
+	ca := m.clipAsks[0]
+	if ca.req.query {
+		return fmt.Sprintf("window %d wants to read the clipboard, allow? (alt+y yes, alt+k no)", ca.id)
+	}
+	return fmt.Sprintf("window %d wants to set the clipboard (%d bytes), allow? (alt+y yes, alt+k no)", ca.id, len(ca.req.data))
+}
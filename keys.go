@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~~~~~~~~~
+// key encoding
+// ~~~~~~~~~~~~~~
+
+// xterm modifier params, 1 + shift(1) + alt(2) + ctrl(4)
+const (
+	modShift = 1
+	modAlt   = 2
+	modCtrl  = 4
+)
+
+// final bytes for the cursor keys and friends, these get CSI or SS3 in front
+var cursorKeys = map[tea.KeyType]struct {
+	final byte
+	mod   int
+} {
+	tea.KeyUp               : {'A', 0},
+	tea.KeyDown             : {'B', 0},
+	tea.KeyRight            : {'C', 0},
+	tea.KeyLeft             : {'D', 0},
+	tea.KeyHome             : {'H', 0},
+	tea.KeyEnd              : {'F', 0},
+	tea.KeyShiftUp          : {'A', modShift},
+	tea.KeyShiftDown        : {'B', modShift},
+	tea.KeyShiftRight       : {'C', modShift},
+	tea.KeyShiftLeft        : {'D', modShift},
+	tea.KeyShiftHome        : {'H', modShift},
+	tea.KeyShiftEnd         : {'F', modShift},
+	tea.KeyCtrlUp           : {'A', modCtrl},
+	tea.KeyCtrlDown         : {'B', modCtrl},
+	tea.KeyCtrlRight        : {'C', modCtrl},
+	tea.KeyCtrlLeft         : {'D', modCtrl},
+	tea.KeyCtrlHome         : {'H', modCtrl},
+	tea.KeyCtrlEnd          : {'F', modCtrl},
+	tea.KeyCtrlShiftUp      : {'A', modCtrl|modShift},
+	tea.KeyCtrlShiftDown    : {'B', modCtrl|modShift},
+	tea.KeyCtrlShiftRight   : {'C', modCtrl|modShift},
+	tea.KeyCtrlShiftLeft    : {'D', modCtrl|modShift},
+	tea.KeyCtrlShiftHome    : {'H', modCtrl|modShift},
+	tea.KeyCtrlShiftEnd     : {'F', modCtrl|modShift},
+	tea.KeyF1               : {'P', 0},
+	tea.KeyF2               : {'Q', 0},
+	tea.KeyF3               : {'R', 0},
+	tea.KeyF4               : {'S', 0},
+	tea.KeyF13              : {'P', modShift},
+	tea.KeyF14              : {'Q', modShift},
+	tea.KeyF15              : {'R', modShift},
+	tea.KeyF16              : {'S', modShift},
+}
+
+// numbers for the keys that are sent as CSI <n> ~
+var tildeKeys = map[tea.KeyType]struct {
+	num int
+	mod int
+} {
+	tea.KeyInsert     : {2, 0},
+	tea.KeyDelete     : {3, 0},
+	tea.KeyPgUp       : {5, 0},
+	tea.KeyPgDown     : {6, 0},
+	tea.KeyCtrlPgUp   : {5, modCtrl},
+	tea.KeyCtrlPgDown : {6, modCtrl},
+	tea.KeyF5         : {15, 0},
+	tea.KeyF6         : {17, 0},
+	tea.KeyF7         : {18, 0},
+	tea.KeyF8         : {19, 0},
+	tea.KeyF9         : {20, 0},
+	tea.KeyF10        : {21, 0},
+	tea.KeyF11        : {23, 0},
+	tea.KeyF12        : {24, 0},
+	tea.KeyF17        : {15, modShift},
+	tea.KeyF18        : {17, modShift},
+	tea.KeyF19        : {18, modShift},
+	tea.KeyF20        : {19, modShift},
+}
+
+// turn a key press into the bytes an xterm would have sent the program for it.
+// appCur is the window's DECCKM state, which picks SS3 over CSI for the arrows
+func keyBytes (k tea.KeyMsg, appCur bool) []byte {
+	if ck, ok := cursorKeys[k.Type]; ok {
+		mod := ck.mod
+		if k.Alt {
+			mod |= modAlt
+		}
+		isF := ck.final >= 'P' && ck.final <= 'S'
+		switch {
+			case mod != 0:
+				return []byte(fmt.Sprintf("\x1b[1;%d%c", mod+1, ck.final))
+			case appCur || isF:
+				return []byte{0x1b, 'O', ck.final}
+			default:
+				return []byte{0x1b, '[', ck.final}
+		}
+	}
+	if tk, ok := tildeKeys[k.Type]; ok {
+		mod := tk.mod
+		if k.Alt {
+			mod |= modAlt
+		}
+		if mod != 0 {
+			return []byte(fmt.Sprintf("\x1b[%d;%d~", tk.num, mod+1))
+		}
+		return []byte(fmt.Sprintf("\x1b[%d~", tk.num))
+	}
+	var b []byte
+	switch {
+		case k.Type == tea.KeyRunes:
+			b = []byte(string(k.Runes))
+		case k.Type == tea.KeySpace:
+			b = []byte{' '}
+		case k.Type == tea.KeyShiftTab:
+			return []byte("\x1b[Z")
+		case k.Type >= 0 && k.Type <= 0x1f, k.Type == tea.KeyBackspace:
+			// control keys are just their own byte, this covers enter, tab, esc and backspace too
+			b = []byte{byte(k.Type)}
+		default:
+			return nil
+	}
+	if k.Alt { // meta sends an escape first
+		b = append([]byte{0x1b}, b...)
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestKeyBytes (t *testing.T) {
+	runes := func (s string) tea.KeyMsg {
+		return tea.KeyMsg { Type: tea.KeyRunes, Runes: []rune(s) }
+	}
+	alt := func (k tea.KeyMsg) tea.KeyMsg {
+		k.Alt = true
+		return k
+	}
+	key := func (kt tea.KeyType) tea.KeyMsg {
+		return tea.KeyMsg { Type: kt }
+	}
+	tests := []struct {
+		name   string
+		k      tea.KeyMsg
+		appCur bool
+		want   string
+	}{
+		{"up", key(tea.KeyUp), false, "\x1b[A"},
+		{"left", key(tea.KeyLeft), false, "\x1b[D"},
+		{"up with DECCKM", key(tea.KeyUp), true, "\x1bOA"},
+		{"home with DECCKM", key(tea.KeyHome), true, "\x1bOH"},
+		{"end", key(tea.KeyEnd), false, "\x1b[F"},
+		{"shift up", key(tea.KeyShiftUp), false, "\x1b[1;2A"},
+		{"alt up", alt(key(tea.KeyUp)), false, "\x1b[1;3A"},
+		{"ctrl up", key(tea.KeyCtrlUp), false, "\x1b[1;5A"},
+		{"ctrl up ignores DECCKM", key(tea.KeyCtrlUp), true, "\x1b[1;5A"},
+		{"ctrl shift right", key(tea.KeyCtrlShiftRight), false, "\x1b[1;6C"},
+		{"alt ctrl shift left", alt(key(tea.KeyCtrlShiftLeft)), false, "\x1b[1;8D"},
+		{"f1", key(tea.KeyF1), false, "\x1bOP"},
+		{"f2", key(tea.KeyF2), false, "\x1bOQ"},
+		{"f3", key(tea.KeyF3), true, "\x1bOR"},
+		{"f4", key(tea.KeyF4), false, "\x1bOS"},
+		{"f13 is shift f1", key(tea.KeyF13), false, "\x1b[1;2P"},
+		{"insert", key(tea.KeyInsert), false, "\x1b[2~"},
+		{"delete", key(tea.KeyDelete), false, "\x1b[3~"},
+		{"page up", key(tea.KeyPgUp), false, "\x1b[5~"},
+		{"ctrl page down", key(tea.KeyCtrlPgDown), false, "\x1b[6;5~"},
+		{"alt delete", alt(key(tea.KeyDelete)), false, "\x1b[3;3~"},
+		{"f5", key(tea.KeyF5), false, "\x1b[15~"},
+		{"f12", key(tea.KeyF12), false, "\x1b[24~"},
+		{"f20 is shift f8", key(tea.KeyF20), false, "\x1b[19;2~"},
+		{"runes", runes("hé"), false, "hé"},
+		{"space", key(tea.KeySpace), false, " "},
+		{"enter", key(tea.KeyEnter), false, "\r"},
+		{"tab", key(tea.KeyTab), false, "\t"},
+		{"shift tab", key(tea.KeyShiftTab), false, "\x1b[Z"},
+		{"esc", key(tea.KeyEsc), false, "\x1b"},
+		{"ctrl c", key(tea.KeyCtrlC), false, "\x03"},
+		{"ctrl a", key(tea.KeyCtrlA), false, "\x01"},
+		{"ctrl at", key(tea.KeyCtrlAt), false, "\x00"},
+		{"ctrl backslash", key(tea.KeyCtrlBackslash), false, "\x1c"},
+		{"backspace", key(tea.KeyBackspace), false, "\x7f"},
+		{"alt runes", alt(runes("x")), false, "\x1bx"},
+		{"alt backspace", alt(key(tea.KeyBackspace)), false, "\x1b\x7f"},
+		{"alt ctrl c", alt(key(tea.KeyCtrlC)), false, "\x1b\x03"},
+		{"alt space", alt(key(tea.KeySpace)), false, "\x1b "},
+	}
+	for _, tc := range tests {
+		if got := string(keyBytes (tc.k, tc.appCur)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~~
+// layout
+// ~~~~~~~
+
+// a saved session, everything needed to bring the same windows back up
+type layout struct {
+	VisWS   byte        `json:"visWS"`
+	BG      int         `json:"bg"`
+	Windows []layoutWin `json:"windows"` // bottom of the stack first
+}
+
+type layoutWin struct {
+	Name     string   `json:"name,omitempty"`
+	LockName bool     `json:"lockName,omitempty"`
+	Cmd      []string `json:"cmd"`
+	Dir      string   `json:"dir,omitempty"`
+	Top      int      `json:"top"`
+	Left     int      `json:"left"`
+	Lines    uint16   `json:"lines"`
+	Cols     uint16   `json:"cols"`
+	OnWS     byte     `json:"onWS"`
+}
+
+// msg for when a layout file has been read
+type LayoutMsg struct {
+	path string
+	l    layout
+	err  error
+}
+
+// msg with something to tell the user, it shows up in the bottom bar
+type NoteMsg string
+
+// where layouts get saved to and loaded from unless another file is given
+func defaultLayout() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "ttywm-layout.json"
+	}
+	return filepath.Join(dir, "ttywm", "layout.json")
+}
+
+// the current session as a layout
+func getLayout (m model) layout {
+	l := layout { VisWS: m.visWS, BG: m.bg }
+	for _, w := range m.windows {
+		if w.play != nil {
+			continue // there's no command to bring it back with
+		}
+		l.Windows = append(l.Windows, layoutWin {
+			Name:     w.name,
+			LockName: w.lockName,
+			Cmd:      w.cmd.Args,
+			Dir:      winCwd (w),
+			Top:      w.top,
+			Left:     w.left,
+			Lines:    w.lines,
+			Cols:     w.cols,
+			OnWS:     w.onWS,
+		})
+	}
+	return l
+}
+
+// write the current session out to path
+func saveLayout (m model, path string) tea.Cmd {
+	l := getLayout (m) // has to be done now, the windows can change before the cmd runs
+	return func() tea.Msg {
+		b, err := json.MarshalIndent(l, "", "\t")
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(path, append(b, '\n'), 0o644)
+		}
+		if err != nil {
+			return NoteMsg(fmt.Sprintf("couldn't save layout: %v", err))
+		}
+		return NoteMsg(fmt.Sprintf("saved %d windows to %s", len(l.Windows), path))
+	}
+}
+
+// read a layout in from path
+func loadLayout (path string) tea.Cmd {
+	return func() tea.Msg {
+		var l layout
+		b, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &l)
+		}
+		return LayoutMsg { path: path, l: l, err: err }
+	}
+}
+
+// open up the windows in a layout on top of whatever's already open
+func useLayout (m model, l layout) (model, tea.Cmd) {
+	if l.VisWS != 0 {
+		m.visWS = l.VisWS
+	}
+	if l.BG >= 0 && l.BG < len(allBGs) {
+		m.bg = l.BG
+	}
+	var cmds []tea.Cmd
+	failed := 0
+	for _, lw := range l.Windows {
+		w := window {
+			id       : m.winCt,
+			name     : lw.Name,
+			lockName : lw.LockName,
+			onWS     : lw.OnWS,
+			top      : lw.Top,
+			lines    : min(max(lw.Lines, 2), maxWinSize),
+			left     : lw.Left,
+			cols     : min(max(lw.Cols, 2), maxWinSize),
+		}
+		argv := lw.Cmd
+		if len(argv) == 0 {
+			argv = []string {"/bin/bash"}
+		}
+		cmd, err := spawn (&w, argv, lw.Dir)
+		if err != nil {
+			failed++
+			continue
+		}
+		m.winCt++
+		m.windows = append(m.windows, w)
+		cmds = append(cmds, cmd)
+	}
+	refocus (&m)
+	if failed > 0 {
+		m.note = fmt.Sprintf("%d of %d windows in the layout didn't start", failed, len(l.Windows))
+	}
+	return m, tea.Batch(cmds...)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~
+// mouse
+// ~~~~~~
+
+// edges of a window that follow the pointer while it's being dragged
+const (
+	edgeTop = 1 << iota
+	edgeBottom
+	edgeLeft
+	edgeRight
+)
+
+// a window being dragged around or resized with the mouse
+// also used for a button held down over a program that tracks the mouse,
+// so it keeps getting the events until the button comes back up
+type drag struct {
+	id    uint // window being dragged
+	edges int // which edges are being dragged, 0 moves the whole window
+	x, y  int // where the pointer was last
+	app   bool // the program in the window has the pointer, not ttywm
+}
+
+// index of the topmost visible window whose box, borders included, is at x, y.
+// -1 if there isn't one
+func winAt (m model, x, y int) int {
+	for i := len(m.windows)-1; i >= 0; i-- {
+		w := m.windows[i]
+		if m.visWS&w.onWS > 0 &&
+			x >= w.left && x <= w.left+int(w.cols)+1 &&
+			y >= w.top && y <= w.top+int(w.lines)+1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// which edges of w are at x, y. the top border is left out, other than its
+// corners, since grabbing it moves the window instead
+func edgesAt (w window, x, y int) int {
+	e := 0
+	switch y {
+		case w.top + int(w.lines) + 1:
+			e |= edgeBottom
+		case w.top:
+			if x == w.left || x == w.left+int(w.cols)+1 {
+				e |= edgeTop
+			}
+	}
+	switch x {
+		case w.left:
+			e |= edgeLeft
+		case w.left + int(w.cols) + 1:
+			e |= edgeRight
+	}
+	return e
+}
+
+// clicking a window raises and focuses it and puts the cursor there,
+// grabbing its top border moves it and grabbing any other edge or a corner
+// resizes it. the wheel scrolls back through whatever window is under the
+// pointer. if the program in a window tracks the mouse, whatever happens
+// inside the border goes to it instead, only the border is ttywm's
+func mouseEvent (m model, msg tea.MouseMsg) (model, tea.Cmd) {
+	if m.drag != nil && m.drag.app {
+		// the program that got the press gets everything up to the release
+		for _, w := range m.windows {
+			if w.id == m.drag.id {
+				sendMouse (w, msg)
+			}
+		}
+		if msg.Action == tea.MouseActionRelease {
+			m.drag = nil
+		}
+		return m, nil
+	}
+	i := winAt (m, msg.X, msg.Y)
+	app := m.drag == nil && i >= 0 && tracksMouse (m.windows[i], msg.X, msg.Y)
+	if app && msg.Action == tea.MouseActionMotion && focusFollowsPointer {
+		focusWin (&m, i)
+	}
+	switch {
+		case app && msg.Action == tea.MouseActionPress && !tea.MouseEvent(msg).IsWheel():
+			w := m.windows[i]
+			m.currX, m.currY = msg.X, msg.Y
+			m.windows = append (m.windows[:i], append(m.windows[i+1:], w)...)
+			focusWin (&m, len(m.windows)-1)
+			m.drag = &drag { id: w.id, app: true }
+			sendMouse (w, msg)
+		case app:
+			sendMouse (m.windows[i], msg)
+		case tea.MouseEvent(msg).IsWheel():
+			if i >= 0 {
+				switch msg.Button {
+					case tea.MouseButtonWheelUp:
+						m.windows[i].term.scrollView(wheelLines)
+					case tea.MouseButtonWheelDown:
+						m.windows[i].term.scrollView(-wheelLines)
+				}
+			}
+		case msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft:
+			m.currX, m.currY = msg.X, msg.Y
+			if i < 0 {
+				return m, nil
+			}
+			// raise and focus the window, the same way alt+f does
+			w := m.windows[i]
+			m.windows = append (m.windows[:i], append(m.windows[i+1:], w)...)
+			focusWin (&m, len(m.windows)-1)
+			e := edgesAt (w, msg.X, msg.Y)
+			if e != 0 || msg.Y == w.top {
+				m.drag = &drag { id: w.id, edges: e, x: msg.X, y: msg.Y }
+			}
+		case msg.Action == tea.MouseActionMotion && m.drag != nil:
+			dragTo (&m, msg.X, msg.Y)
+		case msg.Action == tea.MouseActionMotion && focusFollowsPointer && i >= 0:
+			focusWin (&m, i)
+		case msg.Action == tea.MouseActionRelease:
+			m.drag = nil
+	}
+	return m, nil
+}
+
+// whether x, y is inside w's border and the program in it wants the mouse
+func tracksMouse (w window, x, y int) bool {
+	return w.term.mouse != 0 && !w.exited && w.play == nil &&
+		x > w.left && x <= w.left+int(w.cols) &&
+		y > w.top && y <= w.top+int(w.lines)
+}
+
+// write a mouse event to a window's pty the way its program asked for it,
+// as long as it's an event the tracking mode it turned on reports
+func sendMouse (w window, msg tea.MouseMsg) {
+	if b := mouseBytes (w.term, msg, msg.X-w.left-1, msg.Y-w.top-1); len(b) > 0 {
+		w.pty.Write(b)
+	}
+}
+
+// xterm mouse report for msg at x, y in the window, 0 based. x and y get
+// clamped to the window so a drag that wanders off it still makes sense
+func mouseBytes (t *term, msg tea.MouseMsg, x, y int) []byte {
+	x = min(max(x, 0), t.cols-1) + 1
+	y = min(max(y, 0), t.rows-1) + 1
+	var b int
+	switch msg.Button {
+		case tea.MouseButtonLeft:
+			b = 0
+		case tea.MouseButtonMiddle:
+			b = 1
+		case tea.MouseButtonRight:
+			b = 2
+		case tea.MouseButtonWheelUp:
+			b = 64
+		case tea.MouseButtonWheelDown:
+			b = 65
+		case tea.MouseButtonWheelLeft:
+			b = 66
+		case tea.MouseButtonWheelRight:
+			b = 67
+		case tea.MouseButtonNone:
+			b = 3
+		default:
+			return nil
+	}
+	if msg.Action == tea.MouseActionMotion {
+		switch {
+			case t.mouse == 1003:
+			case t.mouse == 1002 && msg.Button != tea.MouseButtonNone:
+			default:
+				return nil
+		}
+		b += 32
+	}
+	if msg.Shift {
+		b += 4
+	}
+	if msg.Alt {
+		b += 8
+	}
+	if msg.Ctrl {
+		b += 16
+	}
+	if t.sgrMouse {
+		end := 'M'
+		if msg.Action == tea.MouseActionRelease {
+			end = 'm'
+		}
+		return []byte(fmt.Sprintf("\x1b[<%d;%d;%d%c", b, x, y, end))
+	}
+	if msg.Action == tea.MouseActionRelease {
+		b = b&^3 | 3 // the old encoding can't say which button came up
+	}
+	if x > 223 || y > 223 {
+		return nil // too far out to fit in a byte
+	}
+	return []byte{0x1b, '[', 'M', byte(32+b), byte(32+x), byte(32+y)}
+}
+
+// move whatever's being dragged along with the pointer to x, y
+func dragTo (m *model, x, y int) {
+	d := m.drag
+	dx, dy := x-d.x, y-d.y
+	d.x, d.y = x, y
+	m.currX, m.currY = x, y
+	for i := range m.windows {
+		w := &m.windows[i]
+		if w.id != d.id {
+			continue
+		}
+		if d.edges == 0 {
+			w.top += dy
+			w.left += dx
+			return
+		}
+		lines, cols := int(w.lines), int(w.cols)
+		// windows don't get smaller than 2x2, the same as with alt+r
+		if d.edges&edgeTop != 0 {
+			dy = min(dy, lines-2)
+			w.top += dy
+			lines -= dy
+		}
+		if d.edges&edgeBottom != 0 {
+			lines = max(lines+dy, 2)
+		}
+		if d.edges&edgeLeft != 0 {
+			dx = min(dx, cols-2)
+			w.left += dx
+			cols -= dx
+		}
+		if d.edges&edgeRight != 0 {
+			cols = max(cols+dx, 2)
+		}
+		if lines != int(w.lines) || cols != int(w.cols) {
+			w.lines, w.cols = uint16(lines), uint16(cols)
+			resizeWin (*w)
+		}
+		return
+	}
+}
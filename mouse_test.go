@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMouseBytes (t *testing.T) {
+	const sgr = "\x1b[?1006h"
+	x10 := func (b, x, y int) string {
+		return string([]byte { 0x1b, '[', 'M', byte(32+b), byte(32+x), byte(32+y) })
+	}
+	press := func (b tea.MouseButton) tea.MouseMsg {
+		return tea.MouseMsg { Button: b, Action: tea.MouseActionPress }
+	}
+	release := func (b tea.MouseButton) tea.MouseMsg {
+		return tea.MouseMsg { Button: b, Action: tea.MouseActionRelease }
+	}
+	motion := func (b tea.MouseButton) tea.MouseMsg {
+		return tea.MouseMsg { Button: b, Action: tea.MouseActionMotion }
+	}
+	mods := press(tea.MouseButtonLeft)
+	mods.Shift, mods.Alt, mods.Ctrl = true, true, true
+	ctrlRelease := release(tea.MouseButtonRight)
+	ctrlRelease.Ctrl = true
+	tests := []struct {
+		name  string
+		modes string // written to the term first to turn tracking on
+		cols  int
+		msg   tea.MouseMsg
+		x, y  int
+		want  string
+	}{
+		{"sgr press", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonLeft), 4, 2, "\x1b[<0;5;3M"},
+		{"sgr release", "\x1b[?1000h" + sgr, 80, release(tea.MouseButtonLeft), 4, 2, "\x1b[<0;5;3m"},
+		{"sgr right press", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonRight), 0, 0, "\x1b[<2;1;1M"},
+		{"sgr middle release", "\x1b[?1000h" + sgr, 80, release(tea.MouseButtonMiddle), 0, 0, "\x1b[<1;1;1m"},
+		{"sgr wheel up", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonWheelUp), 1, 1, "\x1b[<64;2;2M"},
+		{"sgr wheel down", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonWheelDown), 1, 1, "\x1b[<65;2;2M"},
+		{"x10 press", "\x1b[?1000h", 80, press(tea.MouseButtonLeft), 4, 2, x10(0, 5, 3)},
+		{"x10 release", "\x1b[?1000h", 80, release(tea.MouseButtonRight), 4, 2, x10(3, 5, 3)},
+		{"x10 release keeps modifiers", "\x1b[?1000h", 80, ctrlRelease, 0, 0, x10(19, 1, 1)},
+		{"modifiers", "\x1b[?1000h" + sgr, 80, mods, 0, 0, "\x1b[<28;1;1M"},
+		{"no motion under 1000", "\x1b[?1000h" + sgr, 80, motion(tea.MouseButtonLeft), 0, 0, ""},
+		{"drag under 1002", "\x1b[?1002h" + sgr, 80, motion(tea.MouseButtonLeft), 0, 0, "\x1b[<32;1;1M"},
+		{"no bare motion under 1002", "\x1b[?1002h" + sgr, 80, motion(tea.MouseButtonNone), 0, 0, ""},
+		{"drag under 1003", "\x1b[?1003h" + sgr, 80, motion(tea.MouseButtonRight), 0, 0, "\x1b[<34;1;1M"},
+		{"bare motion under 1003", "\x1b[?1003h" + sgr, 80, motion(tea.MouseButtonNone), 2, 3, "\x1b[<35;3;4M"},
+		{"bare motion in x10", "\x1b[?1003h", 80, motion(tea.MouseButtonNone), 2, 3, x10(35, 3, 4)},
+		{"clamped low", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonLeft), -5, -1, "\x1b[<0;1;1M"},
+		{"clamped high", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonLeft), 500, 99, "\x1b[<0;80;24M"},
+		{"x10 up to 223", "\x1b[?1000h", 300, press(tea.MouseButtonLeft), 222, 0, x10(0, 223, 1)},
+		{"x10 past 223", "\x1b[?1000h", 300, press(tea.MouseButtonLeft), 223, 0, ""},
+		{"sgr past 223", "\x1b[?1000h" + sgr, 300, press(tea.MouseButtonLeft), 250, 0, "\x1b[<0;251;1M"},
+		{"unknown button", "\x1b[?1000h" + sgr, 80, press(tea.MouseButtonBackward), 0, 0, ""},
+	}
+	for _, tc := range tests {
+		tm := newTerm (24, tc.cols)
+		tm.write([]byte(tc.modes))
+		if got := string(mouseBytes (tm, tc.msg, tc.x, tc.y)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
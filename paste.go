@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~
+// paste
+// ~~~~~~
+
+// bubbletea doesn't know about bracketed paste, so the start and end of one
+// show up as unknown CSI sequences and these are what they print as
+const (
+	pasteStart = "?CSI[50 48 48 126]?" // ESC[200~
+	pasteEnd   = "?CSI[50 48 49 126]?" // ESC[201~
+)
+
+// how much of a paste gets written to a pty at once
+const pasteChunk = 4096
+
+// turn on bracketed paste in the host terminal so pastes can be told apart from typing
+func hostPaste (on bool) tea.Cmd {
+	return func() tea.Msg {
+		if on {
+			hostOut.Write([]byte("\x1b[?2004h"))
+		} else {
+			hostOut.Write([]byte("\x1b[?2004l"))
+		}
+		return nil
+	}
+}
+
+// a paste is over, hand everything in it to the text input if it's up or
+// the focused window otherwise
+func endPaste (m *model) tea.Cmd {
+	b := m.paste
+	m.paste = nil
+	m.pasting = false
+	if m.gtxtin.Focused() {
+		// it's one line, so no control characters
+		s := strings.Map(func (r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+			return r
+		}, string(b))
+		m.gtxtin.SetValue(m.gtxtin.Value() + s)
+		m.gtxtin.CursorEnd()
+		return nil
+	}
+	winInd := getFocWinInd (*m)
+	if winInd < 0 || m.windows[winInd].exited || m.windows[winInd].play != nil || len(b) == 0 {
+		return nil
+	}
+	w := m.windows[winInd]
+	if w.term.bpaste {
+		// don't let the paste end itself early and have the rest taken as typing
+		b = bytes.ReplaceAll(b, []byte("\x1b[201~"), nil)
+		b = append(append([]byte("\x1b[200~"), b...), "\x1b[201~"...)
+	}
+	w.term.scroll = 0
+	return writePaste (w.pty, b)
+}
+
+// write b to a pty a chunk at a time, away from the ui so a big paste into
+// a program that's slow to read it doesn't hold everything up
+func writePaste (f *os.File, b []byte) tea.Cmd {
+	return func() tea.Msg {
+		for len(b) > 0 {
+			n := min(len(b), pasteChunk)
+			if _, err := f.Write(b[:n]); err != nil {
+				return nil
+			}
+			b = b[n:]
+		}
+		return nil
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~~~~
+// playback
+// ~~~~~~~~~
+
+// one event out of an asciicast file
+type castEvent struct {
+	t    time.Duration // from the start of the recording
+	kind string // "o" for output, "r" for resize, anything else is skipped over
+	data string
+}
+
+// an asciicast recording being played back in a window. it goes through the
+// window's term same as pty output would, there's just no pty
+type player struct {
+	path   string
+	hdr    castHeader
+	events []castEvent
+	pos    int // next event to play
+	at     time.Duration // how far into the recording playback is
+	speed  float64
+	paused bool
+	gen    int // goes up whenever playback is rescheduled, so old PlayMsgs can be told apart
+}
+
+// msg for when a cast file has been read
+type CastMsg struct {
+	path   string
+	hdr    castHeader
+	events []castEvent
+	err    error
+}
+
+// msg for when it's time for a playing window's next event
+type PlayMsg struct {
+	id  uint
+	gen int
+}
+
+// read in an asciicast v2 file
+func loadCast (path string) tea.Cmd {
+	return func() tea.Msg {
+		cm := CastMsg { path: path }
+		f, err := os.Open(path)
+		if err != nil {
+			cm.err = err
+			return cm
+		}
+		defer f.Close()
+		br := bufio.NewReader(f)
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			cm.err = err
+			return cm
+		}
+		if err := json.Unmarshal(line, &cm.hdr); err != nil || cm.hdr.Version != 2 {
+			cm.err = fmt.Errorf("not an asciicast v2 file")
+			return cm
+		}
+		for n := 2; ; n++ {
+			line, err := br.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				var ev []any
+				if json.Unmarshal(line, &ev) != nil || len(ev) != 3 {
+					cm.err = fmt.Errorf("bad event on line %d", n)
+					return cm
+				}
+				t, _ := ev[0].(float64)
+				kind, _ := ev[1].(string)
+				data, _ := ev[2].(string)
+				cm.events = append(cm.events, castEvent { time.Duration(t * float64(time.Second)), kind, data })
+			}
+			if err != nil {
+				break
+			}
+		}
+		return cm
+	}
+}
+
+// open a window at the cursor that plays back a cast
+func playWin (m model, cm CastMsg) (model, tea.Cmd) {
+	w := window {
+		id    : m.winCt,
+		name  : filepath.Base(cm.path),
+		onWS  : m.visWS,
+		top   : m.currY,
+		lines : uint16(min(max(cm.hdr.Height, 2), maxWinSize)),
+		left  : m.currX,
+		cols  : uint16(min(max(cm.hdr.Width, 2), maxWinSize)),
+		play  : &player { path: cm.path, hdr: cm.hdr, events: cm.events, speed: 1 },
+	}
+	w.term = newTerm (int(w.lines), int(w.cols))
+	m.winCt++
+	m.windows = append(m.windows, w)
+	focusWin (&m, len(m.windows)-1)
+	return m, nextEvent (w)
+}
+
+// wait for the next event in a playing window, as long as it isn't paused
+func nextEvent (w window) tea.Cmd {
+	p := w.play
+	p.gen++
+	if p.paused || p.pos >= len(p.events) {
+		return nil
+	}
+	wait := p.events[p.pos].t - p.at
+	wait = min(wait, castIdleMax) // long stretches of nothing get cut short
+	msg := PlayMsg { w.id, p.gen }
+	return tea.Tick(time.Duration(float64(wait) / p.speed), func (time.Time) tea.Msg {
+		return msg
+	})
+}
+
+// play every event up to t, after which the recording is at t. resizes in
+// the recording resize the window along with its term
+func playTo (w *window, t time.Duration) {
+	p := w.play
+	for ; p.pos < len(p.events) && p.events[p.pos].t <= t; p.pos++ {
+		ev := p.events[p.pos]
+		switch ev.kind {
+			case "o":
+				w.term.write([]byte(ev.data))
+			case "r":
+				var cols, lines int
+				if _, err := fmt.Sscanf(ev.data, "%dx%d", &cols, &lines); err == nil && cols > 1 && lines > 1 {
+					lines, cols = min(lines, maxWinSize), min(cols, maxWinSize)
+					w.lines, w.cols = uint16(lines), uint16(cols)
+					w.term.resize(lines, cols)
+				}
+		}
+	}
+	// there's no program to answer or ring for
+	w.term.reply = w.term.reply[:0]
+	w.term.clips = nil
+	w.term.bell = false
+	p.at = t
+}
+
+// jump to t in the recording. going backwards means starting over from a
+// fresh term and playing everything up to t again
+func seek (w *window, t time.Duration) {
+	p := w.play
+	t = max(t, 0)
+	if n := len(p.events); n > 0 {
+		t = min(t, p.events[n-1].t)
+	}
+	if t < p.at {
+		w.lines = uint16(min(max(p.hdr.Height, 2), maxWinSize))
+		w.cols = uint16(min(max(p.hdr.Width, 2), maxWinSize))
+		w.term = newTerm (int(w.lines), int(w.cols))
+		p.pos = 0
+	}
+	playTo (w, t)
+}
+
+// keys for a window that's playing a recording
+func playKey (m model, i int, msg tea.KeyMsg) (model, tea.Cmd) {
+	w := &m.windows[i]
+	p := w.play
+	switch msg.String() {
+		case " ": // pause or keep going
+			p.paused = !p.paused
+		case "left":
+			seek (w, p.at - seekStep)
+		case "right":
+			seek (w, p.at + seekStep)
+		case "home":
+			seek (w, 0)
+		case "end":
+			seek (w, time.Duration(1<<62))
+		case "+", "=", "up":
+			p.speed = min(p.speed*2, 64)
+		case "-", "down":
+			p.speed = max(p.speed/2, 1.0/64)
+		case "q":
+			m.windows = append (m.windows[:i], m.windows[i+1:]...)
+			refocus (&m)
+			return m, nil
+		default:
+			return m, nil
+	}
+	w.term.scroll = 0
+	return m, nextEvent (*w)
+}
+
+// what goes in the bottom border of a playing window
+func playLabel (p *player) string {
+	st := "▶"
+	switch {
+		case p.pos >= len(p.events):
+			st = "done"
+		case p.paused:
+			st = "paused"
+	}
+	end := time.Duration(0)
+	if n := len(p.events); n > 0 {
+		end = p.events[n-1].t
+	}
+	return fmt.Sprintf("%s %.1f/%.1fs x%g spc ←→ +- q", st, p.at.Seconds(), end.Seconds(), p.speed)
+}
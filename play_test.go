@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCast = `{"version": 2, "width": 10, "height": 3, "timestamp": 1700000000}
+[0.5, "o", "hello"]
+[1.0, "o", "\r\nworld"]
+
+[1.5, "r", "20x4"]
+[2.0, "i", "typed"]
+[2.5, "o", "\r\n\u001b[31mred\u001b[0m and a much longer line"]
+[3.0, "o", "\u001b[2J\u001b[Hcleared"]
+`
+
+// read a cast out of a temp file with contents in it
+func castFrom (t *testing.T, contents string) CastMsg {
+	path := filepath.Join(t.TempDir(), "test.cast")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return loadCast (path)().(CastMsg)
+}
+
+func TestLoadCast (t *testing.T) {
+	cm := castFrom (t, testCast)
+	if cm.err != nil {
+		t.Fatal(cm.err)
+	}
+	if cm.hdr.Width != 10 || cm.hdr.Height != 3 {
+		t.Errorf("header is %dx%d, want 10x3", cm.hdr.Width, cm.hdr.Height)
+	}
+	kinds := ""
+	for _, ev := range cm.events {
+		kinds += ev.kind
+	}
+	if kinds != "oorioo" {
+		t.Errorf("event kinds are %q, want %q", kinds, "oorioo")
+	}
+	if ev := cm.events[2]; ev.t != 1500*time.Millisecond || ev.data != "20x4" {
+		t.Errorf("resize event is %+v", ev)
+	}
+	if !strings.Contains(cm.events[4].data, "\x1b[31m") {
+		t.Errorf("escapes weren't decoded: %q", cm.events[4].data)
+	}
+
+	bad := []struct {
+		name     string
+		contents string
+		err      string
+	}{
+		{"not json", "hello\n", "not an asciicast v2 file"},
+		{"version 1", `{"version": 1, "width": 10, "height": 3}` + "\n", "not an asciicast v2 file"},
+		{"empty", "", "not an asciicast v2 file"},
+		{"bad event", `{"version": 2, "width": 10, "height": 3}` + "\n[0.1, \"o\", \"a\"]\n[0.2, \"o\"\n", "bad event on line 3"},
+		{"short event", `{"version": 2, "width": 10, "height": 3}` + "\n[0.1, \"o\"]\n", "bad event on line 2"},
+	}
+	for _, tc := range bad {
+		if cm := castFrom (t, tc.contents); cm.err == nil || cm.err.Error() != tc.err {
+			t.Errorf("%s: got error %v, want %q", tc.name, cm.err, tc.err)
+		}
+	}
+}
+
+func TestPlayResize (t *testing.T) {
+	m, _ := playWin (model{}, castFrom (t, testCast))
+	w := &m.windows[0]
+	if w.lines != 3 || w.cols != 10 {
+		t.Fatalf("window starts at %dx%d, want 10x3", w.cols, w.lines)
+	}
+	playTo (w, time.Second)
+	if got := screenStr (w.term); strings.Join(got, "|") != "hello|world|" {
+		t.Errorf("at 1s the screen is %q", got)
+	}
+	playTo (w, 1500*time.Millisecond)
+	if w.lines != 4 || w.cols != 20 || w.term.rows != 4 || w.term.cols != 20 {
+		t.Errorf("after the resize event the window is %dx%d and its term %dx%d, want 20x4",
+			w.cols, w.lines, w.term.cols, w.term.rows)
+	}
+}
+
+func TestPlaySeek (t *testing.T) {
+	cm := castFrom (t, testCast)
+	for _, at := range []time.Duration { 0, 700 * time.Millisecond, time.Second, 1600 * time.Millisecond, 2600 * time.Millisecond } {
+		// straight there
+		m, _ := playWin (model{}, cm)
+		fwd := &m.windows[0]
+		seek (fwd, at)
+		// to the end first and then back
+		m2, _ := playWin (model{}, cm)
+		back := &m2.windows[0]
+		seek (back, time.Hour)
+		if screenStr (back.term)[0] != "cleared" {
+			t.Fatalf("the end of the cast shows %q", screenStr (back.term))
+		}
+		seek (back, at)
+		if f, b := screenStr (fwd.term), screenStr (back.term); strings.Join(f, "|") != strings.Join(b, "|") {
+			t.Errorf("at %v: played forward the screen is %q, seeking back it's %q", at, f, b)
+		}
+		if fwd.cols != back.cols || fwd.lines != back.lines {
+			t.Errorf("at %v: played forward the window is %dx%d, seeking back it's %dx%d", at, fwd.cols, fwd.lines, back.cols, back.lines)
+		}
+		if fwd.term.curX != back.term.curX || fwd.term.curY != back.term.curY || fwd.term.pen != back.term.pen {
+			t.Errorf("at %v: cursor or pen differs after seeking back", at)
+		}
+		if back.play.at != at || back.play.pos != fwd.play.pos {
+			t.Errorf("at %v: seeking back left playback at %v, event %d, want event %d", at, back.play.at, back.play.pos, fwd.play.pos)
+		}
+	}
+}
+
+func TestPlayHugeSizes (t *testing.T) {
+	m, _ := playWin (model{}, castFrom (t, `{"version": 2, "width": 65535, "height": 99999}
+[0.1, "r", "70000x70000"]
+`))
+	w := &m.windows[0]
+	if w.cols != maxWinSize || w.lines != maxWinSize {
+		t.Errorf("window opened at %dx%d, want it clamped to %d", w.cols, w.lines, maxWinSize)
+	}
+	playTo (w, time.Second)
+	if w.cols != maxWinSize || w.lines != maxWinSize || w.term.cols != maxWinSize {
+		t.Errorf("resized to %dx%d, want it clamped to %d", w.cols, w.lines, maxWinSize)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ~~~~~~~~~~
+// recording
+// ~~~~~~~~~~
+
+// a window's output being written to an asciicast v2 file. the header line
+// has the size the window started at, then every chunk of output is an "o"
+// event and every resize an "r" event, timed from when recording started
+type recorder struct {
+	path  string
+	f     *os.File
+	bw    *bufio.Writer
+	start time.Time
+}
+
+// the first line of an asciicast v2 file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// where a window's recording goes unless it's given another file
+func defaultCast (w window) string {
+	return filepath.Join(recordDir, fmt.Sprintf("ttywm-%d-%s.cast", w.id, time.Now().Format("20060102-150405")))
+}
+
+// start recording w to path
+func startRec (w window, path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder { path: path, f: f, bw: bufio.NewWriter(f), start: time.Now() }
+	hdr, _ := json.Marshal(castHeader {
+		Version:   2,
+		Width:     int(w.cols),
+		Height:    int(w.lines),
+		Timestamp: r.start.Unix(),
+		Title:     winName (w),
+		Env:       map[string]string { "TERM": "xterm-256color", "SHELL": w.cmd.Args[0] },
+	})
+	r.bw.Write(append(hdr, '\n'))
+	return r, nil
+}
+
+// write out one event
+func (r *recorder) event (kind, data string) {
+	ev, _ := json.Marshal([]any { time.Since(r.start).Seconds(), kind, data })
+	r.bw.Write(append(ev, '\n'))
+}
+
+// a chunk of output from the window's pty
+func (r *recorder) output (b []byte) {
+	if r != nil {
+		r.event("o", string(b))
+	}
+}
+
+// the window got resized
+func (r *recorder) resize (cols, lines uint16) {
+	if r != nil {
+		r.event("r", fmt.Sprintf("%dx%d", cols, lines))
+	}
+}
+
+// get what's been recorded so far onto the disk
+func (r *recorder) flush() {
+	if r != nil {
+		r.bw.Flush()
+	}
+}
+
+// stop every window's recording
+func stopRecs (ws []window) {
+	for i := range ws {
+		ws[i].rec.stop()
+		ws[i].rec = nil
+	}
+}
+
+func (r *recorder) stop() error {
+	if r == nil {
+		return nil
+	}
+	err := r.bw.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/muesli/termenv"
+	"github.com/rivo/uniseg"
+)
+
+// ~~~~~~~~~~
+// rendering
+// ~~~~~~~~~~
+
+// what the host terminal can show, colors get downgraded to fit it
+var colorProfile = termenv.EnvColorProfile()
+
+// the whole screen as rows of cells, everything gets drawn into this from
+// the wallpaper up and it's turned into a string at the very end
+type screen [][]cell
+
+// a w x h screen with lines of plain text in it
+func newScreen (w, h int, strs []string) screen {
+	scr := make(screen, h)
+	for y := range scr {
+		scr[y] = make([]cell, w)
+		for x := range scr[y] {
+			scr[y][x] = blankCell
+		}
+		if y < len(strs) {
+			scr.putStr(0, y, strs[y])
+		}
+	}
+	return scr
+}
+
+// put c at x, y. anything off the edge of the screen is clipped, and if c
+// lands on half of a wide character the other half gets blanked out
+func (scr screen) set (x, y int, c cell) {
+	if y < 0 || y >= len(scr) || x < 0 || x >= len(scr[y]) {
+		return
+	}
+	row := scr[y]
+	switch {
+		case row[x].wide == wideR && x > 0:
+			row[x-1] = cell { rn: ' ', fg: row[x-1].fg, bg: row[x-1].bg, attr: row[x-1].attr }
+		case row[x].wide == wideL && x+1 < len(row):
+			row[x+1] = cell { rn: ' ', fg: row[x+1].fg, bg: row[x+1].bg, attr: row[x+1].attr }
+	}
+	row[x] = c
+}
+
+// write s unstyled starting at x, y. it goes by grapheme cluster, so wide
+// ones take up two cells and combining marks stay with what they combine with
+func (scr screen) putStr (x, y int, s string) {
+	state := -1
+	for len(s) > 0 {
+		var cl string
+		var w int
+		cl, s, w, state = uniseg.FirstGraphemeClusterInString(s, state)
+		r, n := utf8.DecodeRuneInString(cl)
+		c := cell { rn: r, comb: toComb (cl[n:]) }
+		switch {
+			case w == 0:
+				continue
+			case w > 1:
+				w = 2
+				scr.set(x+1, y, cell { rn: ' ', wide: wideR })
+				c.wide = wideL
+		}
+		scr.set(x, y, c)
+		x += w
+	}
+}
+
+// how many columns s takes up on screen
+func strWidth (s string) int {
+	return uniseg.StringWidth(s)
+}
+
+// the part of s from column from up to column to. a wide grapheme cut in
+// half by either end turns into spaces, and s gets padded out with spaces
+// if it's too short, so what comes back is always to-from columns wide
+func cutCols (s string, from, to int) string {
+	var sb strings.Builder
+	col := 0
+	state := -1
+	for len(s) > 0 && col < to {
+		var cl string
+		var w int
+		cl, s, w, state = uniseg.FirstGraphemeClusterInString(s, state)
+		switch {
+			case col >= from && col+w <= to:
+				sb.WriteString(cl)
+			case col+w > from:
+				sb.WriteString(strings.Repeat(" ", min(col+w, to)-max(col, from)))
+		}
+		col += w
+	}
+	if col < to {
+		sb.WriteString(strings.Repeat(" ", to-max(col, from)))
+	}
+	return sb.String()
+}
+
+// s with str written over it starting at column x, whatever of str would
+// stick out past the end of s is cut off
+func overlayStr (s string, x int, str string) string {
+	sw := strWidth (s)
+	x = min(max(x, 0), sw)
+	if x + strWidth (str) > sw {
+		str = cutCols (str, 0, sw-x)
+	}
+	return cutCols (s, 0, x) + str + cutCols (s, x+strWidth (str), sw)
+}
+
+// the screen as one string per row
+func (scr screen) render() []string {
+	strs := make([]string, len(scr))
+	for y, row := range scr {
+		strs[y] = renderCells (row)
+	}
+	return strs
+}
+
+// turn a row of cells into a string with the SGR sequences that style it,
+// a new sequence only goes out where the style changes
+func renderCells (cs []cell) string {
+	var sb strings.Builder
+	cur := cell{} // the style currently in effect
+	for i, c := range cs {
+		if !sameStyle (c, cur) {
+			sb.WriteString(sgrSeq (c))
+			cur = c
+		}
+		switch {
+			case c.wide == wideL && i+1 < len(cs) && cs[i+1].wide == wideR:
+				sb.WriteRune(c.rn) // the right half gets skipped below
+				sb.WriteString(c.comb.String())
+			case c.wide == wideR && i > 0 && cs[i-1].wide == wideL:
+			case c.wide != single:
+				// half a wide character that lost its other half to clipping
+				// or something drawn over it, a space keeps the columns lined up
+				sb.WriteRune(' ')
+			default:
+				sb.WriteRune(c.rn)
+				sb.WriteString(c.comb.String())
+		}
+	}
+	if !sameStyle (cur, cell{}) {
+		sb.WriteString(termenv.CSI + termenv.ResetSeq + "m")
+	}
+	return sb.String()
+}
+
+func sameStyle (a, b cell) bool {
+	return a.fg == b.fg && a.bg == b.bg && a.attr == b.attr
+}
+
+// attributes in the order they go into an SGR sequence
+var attrSeqs = []struct {
+	attr uint16
+	seq  string
+} {
+	{attrBold, termenv.BoldSeq},
+	{attrDim, termenv.FaintSeq},
+	{attrItalic, termenv.ItalicSeq},
+	{attrUnderline, termenv.UnderlineSeq},
+	{attrBlink, termenv.BlinkSeq},
+	{attrReverse, termenv.ReverseSeq},
+	{attrHidden, "8"},
+	{attrStrike, termenv.CrossOutSeq},
+}
+
+// the SGR sequence that resets the style and sets it to c's
+func sgrSeq (c cell) string {
+	seq := []string{termenv.ResetSeq}
+	for _, as := range attrSeqs {
+		if c.attr&as.attr != 0 {
+			seq = append(seq, as.seq)
+		}
+	}
+	if s := termColor (c.fg).Sequence(false); c.fg != colDefault && s != "" {
+		seq = append(seq, s)
+	}
+	if s := termColor (c.bg).Sequence(true); c.bg != colDefault && s != "" {
+		seq = append(seq, s)
+	}
+	return termenv.CSI + strings.Join(seq, ";") + "m"
+}
+
+// a termenv color for c, already downgraded to what colorProfile supports
+func termColor (c tcolor) termenv.Color {
+	v := uint32(c & 0xffffff)
+	var tc termenv.Color
+	switch c &^ 0xffffff {
+		case colIndexed:
+			if v < 16 {
+				tc = termenv.ANSIColor(v)
+			} else {
+				tc = termenv.ANSI256Color(v)
+			}
+		case colRGB:
+			tc = termenv.RGBColor(fmt.Sprintf("#%06x", v))
+		default:
+			return termenv.NoColor{}
+	}
+	if tc = colorProfile.Convert(tc); tc == nil {
+		return termenv.NoColor{}
+	}
+	return tc
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/termenv"
+	goterm "golang.org/x/term"
+)
+
+// ~~~~~~~~~
+// sessions
+// ~~~~~~~~~
+
+// a detachable session is a server process that owns the model and every
+// pty, and clients that attach to it over a unix socket. the server's
+// bubbletea program reads its input from whatever the client types and
+// renders into the client, so a client is just a raw mode terminal passing
+// bytes back and forth
+
+// what a frame between client and server is for
+const (
+	frameInput  = iota // client to server, bytes typed into the client's terminal
+	frameSize // client to server, the client's terminal size. server to client, the session's size in viewport mode
+	frameList // client to server, asking about the session instead of attaching
+	frameOutput // server to client, bytes to write to the client's terminal
+	frameInfo // server to client, what a frameList asked for
+	frameExit // server to client, the client's being let go and why
+	frameCursor // server to client, where ttywm's cursor is in viewport mode
+	frameHost // server to client, bytes for the client's own terminal rather than the screen, like OSC 52 and bells
+)
+
+// everything between client and server goes over the socket as gob encoded frames
+type frame struct {
+	Kind byte
+	Data []byte
+	W, H int
+	RO   bool // on a client's frameSize, it's attaching read only
+	Prof termenv.Profile // on a client's frameSize, the colors its terminal can show
+	X, Y int // on a frameCursor, the cursor's position in the session
+}
+
+// msg for when the colors the session gets drawn in change, it's whatever
+// the least capable attached client can show
+type ProfileMsg termenv.Profile
+
+// what the client's terminal gets put into while it's attached, and taken back out of
+const (
+	clientSetup = "\x1b[?1049h\x1b[H\x1b[2J\x1b[?25l\x1b[?1003h\x1b[?1006h\x1b[?2004h"
+	clientReset = "\x1b[?2004l\x1b[?1006l\x1b[?1003l\x1b[?25h\x1b[?1049l"
+)
+
+// the directory the session sockets go in, only the user gets in it. if it
+// was made by somebody else they could put a socket in there and get sent
+// everything typed into a session, so it isn't used unless it checks out
+func sockDir() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, fmt.Sprintf("ttywm-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, ours (dir, true)
+}
+
+func sockPath (name string) (string, error) {
+	dir, err := sockDir()
+	return filepath.Join(dir, name + ".sock"), err
+}
+
+// make sure path is a directory or socket that belongs to the user, and if
+// it's the directory that nobody else can get into it
+func ours (path string, dir bool) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	switch {
+		case dir && !fi.IsDir():
+			return fmt.Errorf("%s isn't a directory", path)
+		case !dir && fi.Mode()&os.ModeSocket == 0:
+			return fmt.Errorf("%s isn't a socket", path)
+		case !ok || int(st.Uid) != os.Getuid():
+			return fmt.Errorf("%s belongs to someone else", path)
+		case dir && fi.Mode().Perm()&0o077 != 0:
+			return fmt.Errorf("%s can be gotten into by other users", path)
+	}
+	return nil
+}
+
+// dial a session's server, as long as the socket is the user's own
+func dial (name string) (net.Conn, error) {
+	path, err := sockPath (name)
+	if err == nil {
+		err = ours (path, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial("unix", path)
+}
+
+// whether there's a server listening for a session
+func running (name string) bool {
+	conn, err := dial (name)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// how the session's size is worked out when clients' terminals differ
+type sizePolicy int
+
+const (
+	sizeSmallest sizePolicy = iota // fit the smallest client, bigger ones get blank space
+	sizeViewport // fit the biggest client, smaller ones see a piece of it that follows the cursor
+)
+
+// how many frames can be waiting on a client before it's dropped for being too slow
+const clientBacklog = 256
+
+// a client attached to the server
+type client struct {
+	conn net.Conn
+	out  chan frame // frames waiting to go out, a goroutine per client sends them
+	why  string // what the client gets told when out is closed
+	w, h int // size of the client's terminal
+	prof termenv.Profile
+	ro   bool // read only, it watches but what it types is ignored
+}
+
+// send out whatever's queued up for the client until out is closed, then let it go
+func (c *client) run (wg *sync.WaitGroup) {
+	defer wg.Done()
+	enc := gob.NewEncoder(c.conn)
+	for f := range c.out {
+		if enc.Encode(f) != nil {
+			for range c.out {} // keep the server from blocking on it until it notices
+			break
+		}
+	}
+	enc.Encode(frame { Kind: frameExit, Data: []byte(c.why) })
+	c.conn.Close()
+}
+
+// the server side of a session. its output is what the bubbletea program
+// renders, and it goes to every attached client
+type server struct {
+	name    string
+	started time.Time
+	mu      sync.Mutex
+	cls     map[*client]bool // attached clients
+	w, h    int // size of the session
+	prof    termenv.Profile // colors the session's drawn in
+	cx, cy  int // where ttywm's cursor is
+	in      *io.PipeWriter // what clients type goes in here and comes out as the program's input
+	prog    *tea.Program
+	wg      sync.WaitGroup // client goroutines still sending
+}
+
+// send output on to every attached client. one that can't keep up gets dropped
+// rather than holding up the rest
+func (s *server) Write (b []byte) (int, error) {
+	return s.send(frameOutput, b)
+}
+
+// what goes to hostOut in a session. it has to get past a viewport client's
+// copy of the screen to the terminal it's running in
+type hostFrames struct {
+	s *server
+}
+
+func (h hostFrames) Write (b []byte) (int, error) {
+	return h.s.send(frameHost, b)
+}
+
+func (s *server) send (kind byte, b []byte) (int, error) {
+	data := append([]byte(nil), b...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for cl := range s.cls {
+		select {
+			case cl.out <- frame { Kind: kind, Data: data }:
+			default:
+				s.drop(cl, "too far behind, detached")
+			}
+	}
+	return len(b), nil
+}
+
+// hook a client up to the session
+func (s *server) attach (cl *client) {
+	s.mu.Lock()
+	cl.out = make(chan frame, clientBacklog)
+	s.cls[cl] = true
+	s.wg.Add(1)
+	go cl.run(&s.wg)
+	s.mu.Unlock()
+}
+
+func (s *server) detach (cl *client, why string) {
+	s.mu.Lock()
+	s.drop(cl, why)
+	s.mu.Unlock()
+	s.fit(false)
+}
+
+// take a client out of the session, s.mu has to be held
+func (s *server) drop (cl *client, why string) {
+	if s.cls[cl] {
+		delete(s.cls, cl)
+		cl.why = why
+		close(cl.out)
+	}
+}
+
+// work out the session's size from the clients' sizes under clientSize. a
+// change in size, or force, gets the whole screen redrawn for everybody
+func (s *server) fit (force bool) {
+	s.mu.Lock()
+	w, h := 0, 0
+	prof := termenv.TrueColor
+	for cl := range s.cls {
+		prof = max(prof, cl.prof) // higher is fewer colors
+		switch {
+			case w == 0:
+				w, h = cl.w, cl.h
+			case clientSize == sizeViewport:
+				w, h = max(w, cl.w), max(h, cl.h)
+			default:
+				w, h = min(w, cl.w), min(h, cl.h)
+		}
+	}
+	changed := w != 0 && (w != s.w || h != s.h)
+	if changed {
+		s.w, s.h = w, h
+	}
+	recolor := len(s.cls) > 0 && prof != s.prof
+	if recolor {
+		s.prof = prof
+	}
+	if clientSize == sizeViewport && (changed || force) {
+		// clients keep their own copy of the screen at the session's size,
+		// and show the piece of it the cursor's in
+		for cl := range s.cls {
+			select {
+				case cl.out <- frame { Kind: frameSize, W: w, H: h }:
+				default:
+			}
+			select {
+				case cl.out <- frame { Kind: frameCursor, X: s.cx, Y: s.cy }:
+				default:
+			}
+		}
+	}
+	w, h = s.w, s.h
+	s.mu.Unlock()
+	if recolor {
+		s.prog.Send(ProfileMsg(prof))
+	}
+	if changed || force || recolor {
+		s.prog.Send(tea.WindowSizeMsg { Width: w, Height: h })
+	}
+}
+
+// let viewport mode clients know the cursor moved
+func (s *server) cursor (x, y int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x == s.cx && y == s.cy {
+		return
+	}
+	s.cx, s.cy = x, y
+	if clientSize != sizeViewport {
+		return
+	}
+	for cl := range s.cls {
+		select {
+			case cl.out <- frame { Kind: frameCursor, X: x, Y: y }:
+			default:
+		}
+	}
+}
+
+// the model as a server runs it, the same except the server hears about it
+// whenever the cursor moves
+type served struct {
+	model
+	s *server
+}
+
+func (sv served) Update (msg tea.Msg) (tea.Model, tea.Cmd) {
+	m, cmd := sv.model.Update(msg)
+	sv.model = m.(model)
+	sv.s.cursor(sv.currX, sv.currY)
+	return sv, cmd
+}
+
+// talk to one client until it goes away or detaches
+func (s *server) handle (conn net.Conn) {
+	cl := &client { conn: conn }
+	dec := gob.NewDecoder(conn)
+	attached := false
+	defer func() {
+		if attached {
+			s.detach(cl, "") // the client's goroutine closes conn once it's told
+		} else {
+			conn.Close()
+		}
+	}()
+	for {
+		var f frame
+		if dec.Decode(&f) != nil {
+			return
+		}
+		switch f.Kind {
+			case frameList:
+				s.mu.Lock()
+				info := fmt.Sprintf("%s: %d clients, %dx%d, up since %s",
+					s.name, len(s.cls), s.w, s.h, s.started.Format(time.DateTime))
+				s.mu.Unlock()
+				gob.NewEncoder(conn).Encode(frame { Kind: frameInfo, Data: []byte(info) })
+				return
+			case frameSize:
+				s.mu.Lock()
+				cl.w, cl.h, cl.ro, cl.prof = f.W, f.H, f.RO, f.Prof
+				s.mu.Unlock()
+				if !attached {
+					attached = true
+					s.attach(cl)
+				}
+				// a newly attached client needs the whole screen
+				s.fit(true)
+			case frameInput:
+				if !attached {
+					continue
+				}
+				b, det := cutDetach (f.Data)
+				if !cl.ro {
+					s.in.Write(b)
+				}
+				if det {
+					s.detach(cl, "detached from " + s.name)
+					return
+				}
+		}
+	}
+}
+
+// the typed bytes with the detach key taken out, and whether it was in there
+func cutDetach (b []byte) ([]byte, bool) {
+	i := strings.Index(string(b), detachKey)
+	if i < 0 {
+		return b, false
+	}
+	return b[:i], true
+}
+
+// run the server for a session, until the model quits
+func serve (name string, m model) error {
+	path, err := sockPath (name)
+	if err != nil {
+		return err
+	}
+	if running (name) {
+		return fmt.Errorf("session %s is already running", name)
+	}
+	os.Remove(path) // left over from a server that didn't clean up after itself
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	pr, pw := io.Pipe()
+	// the server's own stdout goes nowhere, the colors come from the clients
+	s := &server { name: name, started: time.Now(), in: pw, cls: map[*client]bool{}, prof: termenv.Ascii }
+	colorProfile = s.prof
+	hostOut = hostFrames { s } // OSC 52, bells and the like go to the client too
+	s.prog = tea.NewProgram(served { m, s }, tea.WithInput(pr), tea.WithOutput(s),
+		tea.WithMouseAllMotion(), tea.WithoutSignalHandler())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	fm, err := s.prog.Run()
+	if sv, ok := fm.(served); ok {
+		stopRecs (sv.windows) // in case it ended some way other than alt+esc
+	}
+	ln.Close()
+	s.mu.Lock()
+	for cl := range s.cls {
+		s.drop(cl, "session " + name + " ended")
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// start a server for a session in the background, detached from this
+// terminal, and wait for its socket to show up
+func startServer (name, layout string, size sizePolicy) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string { "-serve", name }
+	if size == sizeViewport {
+		args = append(args, "-viewport")
+	}
+	if layout != "" {
+		args = append(args, "-layout", layout)
+	}
+	c := exec.Command(exe, args...)
+	c.SysProcAttr = &syscall.SysProcAttr { Setsid: true }
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go c.Wait()
+	for i := 0; i < 50; i++ {
+		if running (name) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("session %s didn't start", name)
+}
+
+// attach this terminal to a running session until it's detached or ends.
+// a read only client sees everything but can't type into the session
+func attach (name string, ro bool) error {
+	conn, err := dial (name)
+	if _, refused := err.(*net.OpError); refused || os.IsNotExist(err) {
+		return fmt.Errorf("no session %s", name)
+	} else if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fd := int(os.Stdin.Fd())
+	st, err := goterm.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	os.Stdout.WriteString(clientSetup)
+	enc := gob.NewEncoder(conn)
+	var mu sync.Mutex
+	send := func (f frame) {
+		mu.Lock()
+		enc.Encode(f)
+		mu.Unlock()
+	}
+	vp := &viewport{}
+	prof := termenv.EnvColorProfile()
+	sendSize := func() {
+		if w, h, err := goterm.GetSize(int(os.Stdout.Fd())); err == nil {
+			vp.setSize(w, h)
+			send(frame { Kind: frameSize, W: w, H: h, RO: ro, Prof: prof })
+		}
+	}
+	sendSize()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for range winch {
+			sendSize()
+		}
+	}()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			send(frame { Kind: frameInput, Data: vp.input(buf[:n]) })
+		}
+	}()
+	why := "lost the connection to " + name
+	dec := gob.NewDecoder(conn)
+	for {
+		var f frame
+		if dec.Decode(&f) != nil {
+			break
+		}
+		switch f.Kind {
+			case frameExit:
+				why = string(f.Data)
+			case frameSize: // the server's fitting the session to the biggest client
+				vp.setSession(f.W, f.H)
+				continue
+			case frameCursor:
+				vp.setCursor(f.X, f.Y)
+				continue
+			case frameOutput:
+				vp.output(f.Data)
+				continue
+			case frameHost:
+				vp.host(f.Data)
+				continue
+		}
+		break
+	}
+	os.Stdout.WriteString(clientReset)
+	goterm.Restore(fd, st)
+	if why != "" {
+		fmt.Printf("[%s]\n", why)
+	}
+	return nil
+}
+
+// what a client shows. normally the session's output goes straight to the
+// terminal, but in viewport mode it's run through a term of the session's
+// size and the piece of it that fits gets drawn, kept around the cursor
+type viewport struct {
+	mu   sync.Mutex
+	vt   *term // the session's screen, nil unless the server's in viewport mode
+	w, h int // size of this client's terminal
+	x, y int // top left of the piece of the session being shown
+	cx, cy int // where ttywm's cursor is in the session
+}
+
+func (v *viewport) setSize (w, h int) {
+	v.mu.Lock()
+	v.w, v.h = w, h
+	v.mu.Unlock()
+}
+
+func (v *viewport) setSession (w, h int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.vt == nil {
+		v.vt = newTerm (h, w)
+	} else {
+		v.vt.reset()
+		v.vt.resize(h, w)
+	}
+}
+
+func (v *viewport) setCursor (x, y int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.cx, v.cy = x, y
+	if v.vt != nil {
+		v.draw()
+	}
+}
+
+func (v *viewport) output (b []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.vt == nil {
+		os.Stdout.Write(b)
+		return
+	}
+	v.vt.write(b)
+	// there's nobody to answer, and what's meant for the client's terminal
+	// comes in frameHosts instead
+	v.vt.reply = v.vt.reply[:0]
+	v.vt.clips = nil
+	v.vt.bell = false
+	v.draw()
+}
+
+// write something straight to the client's terminal
+func (v *viewport) host (b []byte) {
+	v.mu.Lock()
+	os.Stdout.Write(b)
+	v.mu.Unlock()
+}
+
+// SGR mouse reports, the only kind clientSetup asks the terminal for
+var sgrMouse = regexp.MustCompile(`\x1b\[<(\d+);(\d+);(\d+)([Mm])`)
+
+// what the client typed, with mouse reports moved from where they are on
+// this terminal to where they are in the session
+func (v *viewport) input (b []byte) []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.vt == nil || v.x == 0 && v.y == 0 {
+		return append([]byte(nil), b...)
+	}
+	return sgrMouse.ReplaceAllFunc(b, func (rep []byte) []byte {
+		p := sgrMouse.FindSubmatch(rep)
+		x, _ := strconv.Atoi(string(p[2]))
+		y, _ := strconv.Atoi(string(p[3]))
+		return fmt.Appendf(nil, "\x1b[<%s;%d;%d%s", p[1], x+v.x, y+v.y, p[4])
+	})
+}
+
+// draw the piece of the session that's in view, v.mu has to be held
+func (v *viewport) draw() {
+	v.follow()
+	var sb strings.Builder
+	for y := 0; y < v.h; y++ {
+		fmt.Fprintf(&sb, "\x1b[%d;1H", y+1)
+		if y+v.y < v.vt.rows {
+			cs := v.vt.lines[y+v.y].cells
+			sb.WriteString(renderCells (cs[min(v.x, len(cs)):min(v.x+v.w, len(cs))]))
+		}
+		sb.WriteString("\x1b[K")
+	}
+	os.Stdout.WriteString(sb.String())
+}
+
+// move the viewport as little as it takes to keep ttywm's cursor in it
+func (v *viewport) follow() {
+	switch {
+		case v.cx < v.x:
+			v.x = v.cx
+		case v.cx >= v.x+v.w:
+			v.x = v.cx-v.w+1
+	}
+	switch {
+		case v.cy < v.y:
+			v.y = v.cy
+		case v.cy >= v.y+v.h:
+			v.y = v.cy-v.h+1
+	}
+	v.x = max(min(v.x, v.vt.cols-v.w), 0)
+	v.y = max(min(v.y, v.vt.rows-v.h), 0)
+}
+
+// print out the sessions that are running, and clean up after ones that aren't
+func listSessions() error {
+	dir, err := sockDir()
+	if err != nil {
+		return err
+	}
+	socks, _ := filepath.Glob(filepath.Join(dir, "*.sock"))
+	if len(socks) == 0 {
+		fmt.Println("no sessions")
+		return nil
+	}
+	for _, sock := range socks {
+		if ours (sock, false) != nil {
+			continue // not one of the user's, leave it alone
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			os.Remove(sock)
+			continue
+		}
+		gob.NewEncoder(conn).Encode(frame { Kind: frameList })
+		var f frame
+		if gob.NewDecoder(conn).Decode(&f) == nil {
+			fmt.Println(string(f.Data))
+		}
+		conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ~~~~~~~~~
+// switcher
+// ~~~~~~~~~
+
+// what happens when the window picked in the switcher isn't on a visible workspace
+type switchRule int
+
+const (
+	switchShowWS switchRule = iota // show the workspaces it's on instead
+	switchBringWin // put it on the workspaces that are showing
+)
+
+// indexes into m.windows in the order the switcher lists them, top of the stack first
+func switcherList (m model) []int {
+	l := make([]int, len(m.windows))
+	for i := range l {
+		l[i] = len(m.windows)-1-i
+	}
+	return l
+}
+
+// open the switcher with the focused window picked out, or the top one
+func openSwitcher (m model) model {
+	m.switcher = true
+	m.swSel = 0
+	for n, i := range switcherList (m) {
+		if m.focused && m.windows[i].id == m.focus {
+			m.swSel = n
+		}
+	}
+	return m
+}
+
+// keys while the switcher is up. it keeps all of them to itself
+func switcherKey (m model, msg tea.KeyMsg) (model, tea.Cmd) {
+	l := switcherList (m)
+	if len(l) == 0 {
+		m.switcher = false
+		return m, nil
+	}
+	m.swSel = min(m.swSel, len(l)-1)
+	k := msg.String()
+	switch k {
+		case "up", "shift+tab", "alt+shift+tab", "alt+w":
+			m.swSel = (m.swSel+len(l)-1) % len(l)
+		case "down", "tab", "alt+tab", "alt+s":
+			m.swSel = (m.swSel+1) % len(l)
+		case "alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8":
+			// toggle the picked window's workspaces, same bits as alt+1-8 everywhere else
+			m.windows[l[m.swSel]].onWS ^= 0b10000000 >> (k[4]-'1')
+		case "enter":
+			i := l[m.swSel]
+			w := &m.windows[i]
+			if m.visWS&w.onWS == 0 {
+				if switchTo == switchShowWS && w.onWS != 0 {
+					m.visWS = w.onWS
+				} else {
+					w.onWS |= m.visWS
+				}
+			}
+			w.urgent = false
+			m.windows = append (m.windows[:i], append(m.windows[i+1:], *w)...)
+			focusWin (&m, len(m.windows)-1)
+			m.switcher = false
+		case "esc", "alt+esc", "q":
+			m.switcher = false
+	}
+	return m, nil
+}
+
+// draw the switcher as a box in the middle of the screen, one row per window
+func drawSwitcher (scr screen, m model) {
+	if len(scr) == 0 {
+		return
+	}
+	l := switcherList (m)
+	rows := make([]string, len(l))
+	wd := strWidth (" ttywm windows ")
+	for n, i := range l {
+		w := m.windows[i]
+		rows[n] = fmt.Sprintf(" %3d %08b  %s  %s ", w.id, w.onWS, winName (w), fgCmd (w))
+		if w.urgent {
+			rows[n] += "! "
+		}
+		wd = max(wd, strWidth (rows[n]))
+	}
+	if len(rows) == 0 {
+		rows = append(rows, " no windows ")
+		wd = max(wd, strWidth (rows[0]))
+	}
+	wd = min(wd, max(len(scr[0])-2, 1))
+	left := max((len(scr[0])-wd-2)/2, 0)
+	top := max((len(scr)-len(rows)-2)/2, 0)
+	scr.putStr(left, top, "╭" + borderLabel (wd, "ttywm windows") + "╮")
+	for n, r := range rows {
+		y := top+n+1
+		scr.putStr(left, y, "│" + cutCols (r, 0, wd) + "│")
+		if n == m.swSel && len(l) > 0 && y < len(scr) {
+			for x := left+1; x <= left+wd && x < len(scr[y]); x++ {
+				scr[y][x].attr |= attrReverse
+			}
+		}
+	}
+	scr.putStr(left, top+len(rows)+1, "╰" + borderLabel (wd, "enter alt+1-8 esc") + "╯")
+}
@@ -0,0 +1,1434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// ~~~~~~~~~~~~~~~~~~~
+// terminal emulation
+// ~~~~~~~~~~~~~~~~~~~
+
+// a color as set by SGR. the top byte says what kind of color it is and
+// the rest is the palette index or the 24 bit rgb value
+type tcolor uint32
+
+const (
+	colDefault tcolor = 0 // whatever the host terminal's default is
+	colIndexed tcolor = 1 << 24 // one of the 256 palette colors
+	colRGB     tcolor = 2 << 24 // truecolor
+)
+
+// text attributes a cell can have
+const (
+	attrBold uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+)
+
+// how a cell takes part in a double width character
+const (
+	single uint8 = iota // an ordinary one column cell
+	wideL // left half of a double width character, holds the rune
+	wideR // right half of a double width character, holds nothing
+)
+
+// a single character cell on a window's screen
+type cell struct {
+	rn   rune // rune shown in the cell, ' ' when blank
+	comb comb // the rest of the grapheme cluster when rn doesn't stand on its own (combining marks, zwj sequences, etc)
+	fg   tcolor
+	bg   tcolor
+	attr uint16
+	wide uint8
+}
+
+var blankCell = cell { rn: ' ' }
+
+// the most bytes a grapheme cluster keeps after its first rune, enough for a
+// handful of combining marks or an emoji zwj sequence like a family of four
+const combMax = 24
+
+// the tail end of a grapheme cluster, kept right in the cell and padded out
+// with zeros. no strings in cells means a row of them has no pointers in it,
+// which keeps blanking and copying rows cheap and gives the gc nothing to scan
+type comb [combMax]byte
+
+// s as a comb, cut down to the whole runes that fit
+func toComb (s string) comb {
+	var c comb
+	if len(s) > combMax {
+		n := combMax
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	copy(c[:], s)
+	return c
+}
+
+func (c comb) String() string {
+	n := bytes.IndexByte(c[:], 0)
+	if n < 0 {
+		n = combMax
+	}
+	return string(c[:n])
+}
+
+// a single row of cells on a window's screen
+type tline struct {
+	cells []cell
+	wrap  bool // true if the text on this row ran off the end and continues on the next row
+}
+
+// states of the escape sequence parser, loosely following the vt500 state
+// diagram at https://vt100.net/emu/dec_ansi_parser
+type pstate int
+
+const (
+	psGround pstate = iota // printing runes
+	psEsc // just saw ESC
+	psEscInter // ESC followed by intermediate bytes
+	psCsi // inside of a CSI sequence, collecting params
+	psCsiInter // CSI sequence after intermediate bytes
+	psCsiIgnore // malformed CSI sequence, eat it up to the final byte
+	psOsc // inside of an OSC string
+	psStr // inside of a DCS/SOS/PM/APC string we don't care about
+)
+
+// cursor state saved by DECSC and restored by DECRC
+type savedCur struct {
+	x, y     int
+	pen      cell
+	wrapNext bool
+	origin   bool
+	gsets    [2]bool
+	gl       int
+}
+
+// term is the emulator state for a single window, it eats everything the pty
+// spits out and keeps a rows x cols grid of cells up to date
+type term struct {
+	rows     int
+	cols     int
+	lines    []tline // the screen being shown, always len(lines) == rows
+	other    []tline // the screen not being shown, primary or alternate
+	onAlt    bool // whether the alternate screen is the one being shown
+	sb       ring // scrollback, rows that have scrolled off the top of the primary screen
+	scroll   int // how many rows back into the scrollback the window is being viewed, 0 is live
+	curX     int // cursor column
+	curY     int // cursor row
+	wrapNext bool // cursor is sitting past the last column, the next rune wraps
+	pen      cell // colors and attributes that printed runes get
+	top      int // first row of the scrolling region
+	bot      int // last row of the scrolling region
+	tabs     []bool // tab stops
+	autowrap bool // DECAWM
+	origin   bool // DECOM, cursor addressing is relative to the scrolling region
+	insert   bool // IRM, printed runes push the rest of the line right
+	showCur  bool // DECTCEM
+	appCur   bool // DECCKM, arrow keys send SS3 instead of CSI
+	gsets    [2]bool // whether G0/G1 are set to the DEC line drawing set
+	gl       int // which of G0/G1 is invoked
+	saved    savedCur
+	otherSaved savedCur // DECSC state for the screen not being shown, each screen has its own
+	lastRn   rune // last printed rune, for REP
+	lastX    int // where the last printed rune went, so combining marks and the like
+	lastY    int // that come after it can be added on to it
+	state    pstate
+	pbuf     []byte // raw parameter bytes of the current CSI sequence
+	pv       []int // params() parses into this so it doesn't allocate every sequence
+	fields   []string // same for the fields and sub-fields sgr() splits the params into
+	sub      []string
+	gone     []tline // rows on their way off the screen while it scrolls
+	priv     byte // private marker of the current CSI sequence ('?', '>', etc)
+	inter    []byte // intermediate bytes of the current ESC/CSI sequence
+	osc      []byte // body of the current OSC string
+	reply    []byte // answers to queries waiting to be written back to the pty
+	title    string // title set by the program through OSC 0/2
+	titles   []string // titles saved by XTWINOPS 22
+	clips    []clipReq // OSC 52 clipboard requests waiting on the window manager
+	cwd      string // directory the program said it's in with OSC 7
+	bell     bool // a BEL came through that the window manager hasn't seen yet
+	mouse    int // mouse tracking the program turned on, 1000, 1002 or 1003, 0 for none
+	sgrMouse bool // mode 1006, mouse events get reported as SGR sequences
+	bpaste   bool // mode 2004, pastes get wrapped in ESC[200~ and ESC[201~
+}
+
+// a program asking to set or read the clipboard through OSC 52
+type clipReq struct {
+	sel   string // which selections, as the program named them (c, p, s, 0-7)
+	data  []byte // what to put on the clipboard, empty clears it
+	query bool // whether it wants to know what's on the clipboard instead
+}
+
+// limits on how long a title can be and how many can be pushed on the stack
+const (
+	maxTitle  = 256
+	maxTitles = 16
+)
+
+// longest OSC string that gets kept, anything past it is dropped. it has to
+// fit a decent sized clipboard in base64
+const maxOsc = 1 << 20
+
+func newTerm (rows, cols int) *term {
+	t := &term {
+		rows : rows,
+		cols : cols,
+		sb   : ring { buf: make([]tline, scrollbackLen) },
+	}
+	t.reset()
+	return t
+}
+
+// put the terminal back in its power-on state (RIS)
+func (t *term) reset() {
+	t.pen = cell{}
+	t.onAlt = false
+	t.lines = t.crop(nil)
+	t.other = t.crop(nil)
+	t.curX, t.curY = 0, 0
+	t.wrapNext = false
+	t.top, t.bot = 0, t.rows-1
+	t.tabs = make([]bool, t.cols)
+	for i := 8; i < t.cols; i += 8 {
+		t.tabs[i] = true
+	}
+	t.autowrap = true
+	t.origin = false
+	t.insert = false
+	t.showCur = true
+	t.appCur = false
+	t.mouse = 0
+	t.sgrMouse = false
+	t.bpaste = false
+	t.gsets = [2]bool{}
+	t.gl = 0
+	t.saved = savedCur { pen: t.pen }
+	t.otherSaved = t.saved
+	t.state = psGround
+}
+
+func (t *term) blankLine() tline {
+	return t.reuseLine(tline{})
+}
+
+// l's cells blanked out to be used as a new row, so scrolling doesn't have to
+// allocate a row for every line of output. l has to be a row nothing else
+// holds onto anymore, one that fell off the scrollback or the screen
+func (t *term) reuseLine (l tline) tline {
+	cs := l.cells
+	if len(cs) < t.cols { // going past len could run into another row's cells
+		cs = make([]cell, t.cols)
+	}
+	cs = cs[:t.cols]
+	b := t.blank()
+	for i := range cs {
+		cs[i] = b
+	}
+	return tline { cells: cs }
+}
+
+// an erased cell, which keeps the current background color like xterm does
+func (t *term) blank() cell {
+	return cell { rn: ' ', bg: t.pen.bg }
+}
+
+// change the size of the screen. the primary screen gets lines that had
+// wrapped rewrapped so the text flows to the new width the way it would
+// have been printed, the alternate screen is just cut down or padded out
+// since whatever is running on it is going to redraw anyway
+func (t *term) resize (rows, cols int) {
+	if rows == t.rows && cols == t.cols {
+		return
+	}
+	t.rows, t.cols = rows, cols
+	if t.onAlt {
+		t.lines = t.crop(t.lines)
+		t.setCur(t.curX, t.curY)
+		t.other, t.otherSaved.x, t.otherSaved.y = t.reflow(t.other, t.otherSaved.x, t.otherSaved.y)
+	} else {
+		t.lines, t.curX, t.curY = t.reflow(t.lines, t.curX, t.curY)
+		t.other = t.crop(t.other)
+	}
+	t.wrapNext = false
+	t.top, t.bot = 0, rows-1
+	tabs := make([]bool, cols)
+	copy(tabs, t.tabs)
+	for i := (len(t.tabs)+7)/8*8; i < cols; i += 8 {
+		tabs[i] = true
+	}
+	t.tabs = tabs
+	t.saved.x = min(t.saved.x, cols-1)
+	t.saved.y = min(t.saved.y, rows-1)
+	t.otherSaved.x = min(t.otherSaved.x, cols-1)
+	t.otherSaved.y = min(t.otherSaved.y, rows-1)
+}
+
+// rewrap a screen to t.rows x t.cols, returning it and where the cursor at x, y ends up
+func (t *term) reflow (lines []tline, x, y int) ([]tline, int, int) {
+	rows, cols := t.rows, t.cols
+	// the scrollback gets rewrapped along with the screen
+	all := make([]tline, 0, t.sb.n+len(lines))
+	for i := 0; i < t.sb.n; i++ {
+		all = append(all, t.sb.at(i))
+	}
+	y += t.sb.n
+	lines = append(all, lines...)
+	// stitch wrapped rows back into whole logical lines, keeping
+	// track of where the cursor falls in them
+	var logical [][]cell
+	var cur []cell
+	curL, curOff := 0, 0
+	for ly, l := range lines {
+		if ly == y {
+			curL = len(logical)
+			curOff = len(cur) + x
+		}
+		cur = append(cur, l.cells...)
+		if !l.wrap {
+			logical = append(logical, cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		logical = append(logical, cur)
+	}
+	// empty lines below the cursor are just unused screen, don't carry them over
+	last := len(logical)-1
+	for last > curL && blankCells(logical[last]) {
+		last--
+	}
+	logical = logical[:last+1]
+	// now cut them back up at the new width
+	var nl []tline
+	newX, newY := 0, 0
+	for i, lc := range logical {
+		n := len(lc)
+		for n > 0 && lc[n-1] == blankCell {
+			n--
+		}
+		if i == curL {
+			n = max(n, curOff)
+		}
+		lc = lc[:n]
+		off := 0 // how far into the logical line the row being cut starts
+		for {
+			cut := min(len(lc), cols)
+			if cut < len(lc) && cut > 1 && lc[cut-1].wide == wideL {
+				cut-- // don't split a wide rune across rows
+			}
+			last := cut == len(lc)
+			if i == curL && curOff >= off && (curOff < off+cut || last) {
+				newX, newY = curOff-off, len(nl)
+				if newX >= cols { // right at the end of a full row
+					newX, newY = 0, newY+1
+				}
+			}
+			nl = append(nl, tline { cells: padCells(lc[:cut], cols), wrap: !last })
+			if last {
+				break
+			}
+			lc = lc[cut:]
+			off += cut
+		}
+	}
+	for newY >= len(nl) {
+		nl = append(nl, t.blankLine())
+	}
+	// the screen is the bottom rows, unless that would leave the cursor
+	// off the top. everything above it goes back in the scrollback
+	top := min(max(len(nl)-rows, 0), newY)
+	t.sb.clear()
+	t.scroll = 0
+	for _, l := range nl[:top] {
+		t.sb.push(l)
+	}
+	nl, newY = nl[top:], newY-top
+	if len(nl) > rows {
+		nl = nl[:rows]
+	}
+	for len(nl) < rows {
+		nl = append(nl, t.blankLine())
+	}
+	return nl, newX, newY
+}
+
+// cut down or pad out a screen to t.rows x t.cols without rewrapping anything
+func (t *term) crop (lines []tline) []tline {
+	nl := make([]tline, t.rows)
+	for y := range nl {
+		if y < len(lines) {
+			nl[y] = tline { cells: padCells(lines[y].cells[:min(len(lines[y].cells), t.cols)], t.cols) }
+		} else {
+			nl[y] = t.blankLine()
+		}
+	}
+	return nl
+}
+
+// ~~~~~~~~~~~
+// scrollback
+// ~~~~~~~~~~~
+
+// a fixed size ring of rows, once it's full the oldest row gets dropped for each new one
+type ring struct {
+	buf   []tline
+	start int // index in buf of the oldest row
+	n     int // how many rows are in it
+}
+
+// push l onto the ring, what comes back is the row that got dropped to make
+// room, or l itself if the ring can't hold any
+func (r *ring) push (l tline) tline {
+	if len(r.buf) == 0 {
+		return l
+	}
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = l
+		r.n++
+		return tline{}
+	}
+	old := r.buf[r.start]
+	r.buf[r.start] = l
+	r.start = (r.start+1)%len(r.buf)
+	return old
+}
+
+// row i of the ring, 0 is the oldest
+func (r *ring) at (i int) tline {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+func (r *ring) clear() {
+	for i := range r.buf {
+		r.buf[i] = tline{}
+	}
+	r.start, r.n = 0, 0
+}
+
+func (t *term) pushScrollback (l tline) tline {
+	old := t.sb.push(l)
+	// keep whoever is scrolled back looking at the same rows
+	if t.scroll > 0 {
+		t.scroll++
+	}
+	t.scroll = min(t.scroll, t.sb.n)
+	return old
+}
+
+// move the view n rows further back into the scrollback, negative n moves it forward
+func (t *term) scrollView (n int) {
+	t.scroll = min(max(t.scroll+n, 0), t.sb.n)
+}
+
+// row y of what the window is showing, which is the scrollback and
+// screen stitched together and offset by how far it's scrolled back
+func (t *term) viewLine (y int) tline {
+	i := t.sb.n - t.scroll + y
+	if i < t.sb.n {
+		return t.sb.at(i)
+	}
+	return t.lines[i-t.sb.n]
+}
+
+// whether every cell in cs is blank
+func blankCells (cs []cell) bool {
+	for _, c := range cs {
+		if c != blankCell {
+			return false
+		}
+	}
+	return true
+}
+
+// copy cs into a new row that's exactly n cells long, filling with blanks
+func padCells (cs []cell, n int) []cell {
+	row := make([]cell, n)
+	copy(row, cs)
+	for i := len(cs); i < n; i++ {
+		row[i] = blankCell
+	}
+	return row
+}
+
+// text of row y, t.cols columns wide
+func (t *term) lineStr (y int) string {
+	var sb strings.Builder
+	for _, c := range t.lines[y].cells {
+		if c.wide != wideR {
+			sb.WriteRune(c.rn)
+			sb.WriteString(c.comb.String())
+		}
+	}
+	return sb.String()
+}
+
+// ~~~~~~~
+// parser
+// ~~~~~~~
+
+// feed a chunk of pty output through the state machine
+func (t *term) write (b []byte) {
+	for len(b) > 0 {
+		r, n := rune(b[0]), 1
+		if r >= utf8.RuneSelf {
+			r, n = utf8.DecodeRune(b) // bad bytes come out as utf8.RuneError
+		}
+		t.put(r)
+		b = b[n:]
+	}
+}
+
+// feed a single rune of pty output through the state machine
+func (t *term) put (r rune) {
+	// a few things cut across every state
+	switch {
+		case r == 0x18 || r == 0x1a: // CAN and SUB abort any sequence
+			t.state = psGround
+			return
+		case r == 0x1b:
+			if t.state == psOsc {
+				t.oscDispatch() // ESC \ (ST) ends the string, the \ is eaten as a no-op escape
+			}
+			t.state = psEsc
+			t.inter = t.inter[:0]
+			return
+		case r >= 0x80 && r < 0xa0: // C1 controls, utf-8 terminals don't honor these
+			return
+	}
+	switch t.state {
+		case psGround:
+			if r < 0x20 || r == 0x7f {
+				t.execute(r)
+			} else {
+				t.print(r)
+			}
+		case psEsc, psEscInter:
+			switch {
+				case r < 0x20:
+					t.execute(r)
+				case r < 0x30:
+					t.inter = append(t.inter, byte(r))
+					t.state = psEscInter
+				case t.state == psEsc && r == '[':
+					t.pbuf = t.pbuf[:0]
+					t.inter = t.inter[:0]
+					t.priv = 0
+					t.state = psCsi
+				case t.state == psEsc && r == ']':
+					t.osc = t.osc[:0]
+					t.state = psOsc
+				case t.state == psEsc && (r == 'P' || r == 'X' || r == '^' || r == '_'):
+					t.state = psStr
+				case r < 0x7f:
+					t.state = psGround
+					t.escDispatch(r)
+				case r > 0x7f:
+					t.state = psGround
+			}
+		case psCsi, psCsiInter, psCsiIgnore:
+			switch {
+				case r < 0x20:
+					t.execute(r)
+				case r < 0x30:
+					if t.state != psCsiIgnore {
+						t.inter = append(t.inter, byte(r))
+						t.state = psCsiInter
+					}
+				case r < 0x40:
+					switch {
+						case t.state != psCsi:
+							t.state = psCsiIgnore
+						case r >= '<' && r <= '?':
+							if len(t.pbuf) == 0 && t.priv == 0 {
+								t.priv = byte(r)
+							} else {
+								t.state = psCsiIgnore
+							}
+						default:
+							t.pbuf = append(t.pbuf, byte(r))
+					}
+				case r < 0x7f:
+					if t.state != psCsiIgnore {
+						t.csiDispatch(r)
+					}
+					t.state = psGround
+				case r > 0x7f:
+					t.state = psGround
+			}
+		case psOsc:
+			if r == 0x07 { // BEL also ends an OSC string
+				t.oscDispatch()
+				t.state = psGround
+			} else if r >= 0x20 && len(t.osc) < maxOsc {
+				t.osc = append(t.osc, string(r)...)
+			}
+		case psStr:
+			// everything up to ST is thrown away
+	}
+}
+
+// run a C0 control character
+func (t *term) execute (r rune) {
+	switch r {
+		case '\b':
+			t.wrapNext = false
+			if t.curX > 0 {
+				t.curX--
+			}
+		case '\t':
+			t.tabForward(1)
+		case '\n', '\v', '\f':
+			t.lineFeed()
+		case '\r':
+			t.wrapNext = false
+			t.curX = 0
+		case '\a':
+			t.bell = true
+		case 0x0e: // SO, invoke G1
+			t.gl = 1
+		case 0x0f: // SI, invoke G0
+			t.gl = 0
+	}
+}
+
+func (t *term) escDispatch (r rune) {
+	if len(t.inter) > 0 {
+		switch t.inter[0] {
+			case '(', ')': // designate G0/G1
+				t.gsets[t.inter[0]-'('] = r == '0'
+			case '#':
+				if r == '8' { // DECALN, fill the screen with E's
+					for y := range t.lines {
+						for x := range t.lines[y].cells {
+							t.lines[y].cells[x] = cell { rn: 'E' }
+						}
+					}
+					t.top, t.bot = 0, t.rows-1
+					t.setCur(0, 0)
+				}
+		}
+		return
+	}
+	switch r {
+		case '7': // DECSC
+			t.saveCur()
+		case '8': // DECRC
+			t.restoreCur()
+		case 'D': // IND
+			t.lineFeed()
+		case 'E': // NEL
+			t.curX = 0
+			t.lineFeed()
+		case 'M': // RI
+			t.reverseIndex()
+		case 'H': // HTS
+			t.tabs[t.curX] = true
+		case 'c': // RIS
+			t.reset()
+	}
+}
+
+func (t *term) csiDispatch (r rune) {
+	ps := t.params()
+	p := func (i, def int) int { // param i, or def if it's missing or zero
+		if i < len(ps) && ps[i] > 0 {
+			return ps[i]
+		}
+		return def
+	}
+	if len(t.inter) > 0 {
+		if string(t.inter) == "$" && r == 'p' { // DECRQM
+			t.reportMode(p(0, 0))
+		}
+		return
+	}
+	if t.priv != 0 {
+		switch {
+			case r == 'h':
+				t.setPrivModes(ps, true)
+			case r == 'l':
+				t.setPrivModes(ps, false)
+			case r == 'c' && t.priv == '>': // DA2, say we're a vt220
+				t.replyf("\x1b[>1;10;0c")
+			case r == 'c' && t.priv == '=': // DA3, a unit id of all zeros
+				t.replyf("\x1bP!|00000000\x1b\\")
+			case r == 'q' && t.priv == '>': // XTVERSION
+				t.replyf("\x1bP>|ttywm(%s)\x1b\\", version)
+			case r == 'n' && t.priv == '?' && p(0, 0) == 6: // DECXCPR
+				x, y := t.curPos()
+				t.replyf("\x1b[?%d;%d;1R", y, x)
+		}
+		return
+	}
+	switch r {
+		case 'c': // DA1, a vt220 with ansi color
+			if p(0, 0) == 0 {
+				t.replyf("\x1b[?62;22c")
+			}
+		case 'n': // DSR
+			switch p(0, 0) {
+				case 5: // status, always ok
+					t.replyf("\x1b[0n")
+				case 6: // CPR
+					x, y := t.curPos()
+					t.replyf("\x1b[%d;%dR", y, x)
+			}
+		case 't': // XTWINOPS, the size reports and the title stack
+			switch p(0, 0) {
+				case 18: // text area size
+					t.replyf("\x1b[8;%d;%dt", t.rows, t.cols)
+				case 19: // screen size, which as far as the program knows is the window
+					t.replyf("\x1b[9;%d;%dt", t.rows, t.cols)
+				case 22: // push the title, 1 would be the icon name only
+					if p(1, 0) != 1 {
+						t.titles = append(t.titles, t.title)
+						if len(t.titles) > maxTitles {
+							t.titles = t.titles[1:]
+						}
+					}
+				case 23: // pop it back off
+					if n := len(t.titles); p(1, 0) != 1 && n > 0 {
+						t.title = t.titles[n-1]
+						t.titles = t.titles[:n-1]
+					}
+			}
+		case '@': // ICH
+			t.insertBlanks(p(0, 1))
+		case 'A': // CUU
+			t.setCur(t.curX, max(t.curY-p(0, 1), t.upperBound()))
+		case 'B', 'e': // CUD, VPR
+			t.setCur(t.curX, min(t.curY+p(0, 1), t.lowerBound()))
+		case 'C', 'a': // CUF, HPR
+			t.setCur(t.curX+p(0, 1), t.curY)
+		case 'D': // CUB
+			t.setCur(t.curX-p(0, 1), t.curY)
+		case 'E': // CNL
+			t.setCur(0, min(t.curY+p(0, 1), t.lowerBound()))
+		case 'F': // CPL
+			t.setCur(0, max(t.curY-p(0, 1), t.upperBound()))
+		case 'G', '`': // CHA, HPA
+			t.setCur(p(0, 1)-1, t.curY)
+		case 'd': // VPA
+			t.moveTo(t.curX, p(0, 1)-1)
+		case 'H', 'f': // CUP, HVP
+			t.moveTo(p(1, 1)-1, p(0, 1)-1)
+		case 'I': // CHT
+			t.tabForward(p(0, 1))
+		case 'Z': // CBT
+			t.tabBackward(p(0, 1))
+		case 'J': // ED
+			t.eraseDisplay(p(0, 0))
+		case 'K': // EL
+			t.eraseLine(p(0, 0))
+		case 'L': // IL
+			if t.curY >= t.top && t.curY <= t.bot {
+				t.scrollDown(t.curY, t.bot, p(0, 1))
+				t.setCur(0, t.curY)
+			}
+		case 'M': // DL
+			if t.curY >= t.top && t.curY <= t.bot {
+				t.scrollUp(t.curY, t.bot, p(0, 1))
+				t.setCur(0, t.curY)
+			}
+		case 'P': // DCH
+			t.deleteChars(p(0, 1))
+		case 'X': // ECH
+			t.wrapNext = false
+			t.clearCells(t.curY, t.curX, t.curX+p(0, 1))
+		case 'S': // SU
+			t.scrollUp(t.top, t.bot, p(0, 1))
+		case 'T': // SD
+			t.scrollDown(t.top, t.bot, p(0, 1))
+		case 'b': // REP
+			if t.lastRn != 0 {
+				for i := 0; i < min(p(0, 1), t.rows*t.cols); i++ {
+					t.print(t.lastRn)
+				}
+			}
+		case 'g': // TBC
+			switch p(0, 0) {
+				case 0:
+					t.tabs[t.curX] = false
+				case 3:
+					t.tabs = make([]bool, t.cols)
+			}
+		case 'm': // SGR
+			t.sgr()
+		case 'h', 'l': // SM, RM
+			for _, mode := range ps {
+				if mode == 4 {
+					t.insert = r == 'h'
+				}
+			}
+		case 'r': // DECSTBM
+			top, bot := p(0, 1)-1, p(1, t.rows)-1
+			if bot >= t.rows {
+				bot = t.rows-1
+			}
+			if top < bot {
+				t.top, t.bot = top, bot
+				t.moveTo(0, 0)
+			}
+		case 's': // SCOSC
+			t.saveCur()
+		case 'u': // SCORC
+			t.restoreCur()
+	}
+}
+
+// called once an OSC string has been fully read
+func (t *term) oscDispatch() {
+	cmd, arg, _ := strings.Cut(string(t.osc), ";")
+	switch cmd {
+		case "0", "2": // window title (0 is the icon name too, which is the same thing here)
+			t.title = cleanTitle (arg)
+		case "7": // working directory, as a file:// url
+			u, err := url.Parse(arg)
+			if err != nil || u.Scheme != "file" || u.Path == "" {
+				return
+			}
+			if h := u.Hostname(); h != "" && h != "localhost" && h != hostname {
+				return // a shell on some other machine, like over ssh
+			}
+			t.cwd = u.Path
+		case "52": // clipboard, what happens with it is up to the window manager
+			sel, data, ok := strings.Cut(arg, ";")
+			if !ok {
+				return
+			}
+			if sel == "" {
+				sel = "s0"
+			}
+			req := clipReq { sel: sel, query: data == "?" }
+			if !req.query {
+				// anything that isn't valid base64 clears the clipboard, like xterm
+				if b, err := base64.StdEncoding.DecodeString(data); err == nil {
+					req.data = b
+				}
+			}
+			t.clips = append(t.clips, req)
+	}
+}
+
+// this machine's name, to tell local OSC 7 reports from remote ones
+var hostname, _ = os.Hostname()
+
+// titles go in borders and bars, so no control characters and nothing huge
+func cleanTitle (s string) string {
+	s = strings.Map(func (r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	if rs := []rune(s); len(rs) > maxTitle {
+		s = string(rs[:maxTitle])
+	}
+	return s
+}
+
+// queue up a reply to a query, it gets written back to the pty once the
+// chunk of output that asked for it has been handled
+func (t *term) replyf (format string, args ...any) {
+	t.reply = fmt.Appendf(t.reply, format, args...)
+}
+
+// the 1 based cursor position as CPR reports it, relative to the scrolling region in origin mode
+func (t *term) curPos() (int, int) {
+	y := t.curY+1
+	if t.origin {
+		y -= t.top
+	}
+	return t.curX+1, y
+}
+
+// answer a DECRQM for mode n, private or ansi depending on t.priv
+func (t *term) reportMode (n int) {
+	// 0 is not recognized, 1 is set, 2 is reset
+	stat := func (known, on bool) int {
+		switch {
+			case !known:
+				return 0
+			case on:
+				return 1
+		}
+		return 2
+	}
+	if t.priv == '?' {
+		known, on := t.privMode(n)
+		t.replyf("\x1b[?%d;%d$y", n, stat(known, on))
+		return
+	}
+	t.replyf("\x1b[%d;%d$y", n, stat(n == 4, t.insert))
+}
+
+// the state of private mode n, and whether it's one we know about at all
+func (t *term) privMode (n int) (bool, bool) {
+	switch n {
+		case 1:
+			return true, t.appCur
+		case 6:
+			return true, t.origin
+		case 7:
+			return true, t.autowrap
+		case 25:
+			return true, t.showCur
+		case 47, 1047, 1049:
+			return true, t.onAlt
+		case 1000, 1002, 1003:
+			return true, t.mouse == n
+		case 1006:
+			return true, t.sgrMouse
+		case 2004:
+			return true, t.bpaste
+	}
+	return false, false
+}
+
+func (t *term) setPrivModes (modes []int, on bool) {
+	if t.priv != '?' {
+		return
+	}
+	for _, mode := range modes {
+		switch mode {
+			case 1:
+				t.appCur = on
+			case 6:
+				t.origin = on
+				t.moveTo(0, 0)
+			case 7:
+				t.autowrap = on
+				if !on {
+					t.wrapNext = false
+				}
+			case 25:
+				t.showCur = on
+			case 1000, 1002, 1003: // mouse tracking, only one at a time and resetting any turns it off
+				t.mouse = 0
+				if on {
+					t.mouse = mode
+				}
+			case 1006:
+				t.sgrMouse = on
+			case 2004:
+				t.bpaste = on
+			case 47: // plain screen switch
+				t.switchScreen(on)
+			case 1047: // the alternate screen gets cleared on the way out
+				if !on && t.onAlt {
+					t.eraseDisplay(2)
+				}
+				t.switchScreen(on)
+			case 1049: // save the cursor and switch to a clean alternate screen
+				if on && !t.onAlt {
+					t.saveCur()
+					t.switchScreen(true)
+					t.eraseDisplay(2)
+				} else if !on && t.onAlt {
+					t.switchScreen(false)
+					t.restoreCur()
+				}
+		}
+	}
+}
+
+// swap between the primary and alternate screens
+func (t *term) switchScreen (alt bool) {
+	if alt == t.onAlt {
+		return
+	}
+	t.lines, t.other = t.other, t.lines
+	t.saved, t.otherSaved = t.otherSaved, t.saved
+	t.onAlt = alt
+	t.wrapNext = false
+}
+
+// set the pen from an SGR sequence. both the ; and : forms of the extended
+// colors are understood (38;5;n, 38:5:n, 38;2;r;g;b, 38:2::r:g:b)
+func (t *term) sgr() {
+	fields := splitInto (t.fields[:0], string(t.pbuf), ';')
+	t.fields = fields
+	for i := 0; i < len(fields); i++ {
+		sub := splitInto (t.sub[:0], fields[i], ':')
+		t.sub = sub
+		n := num(sub[0])
+		switch {
+			case n == 0:
+				t.pen = cell{}
+			case n == 1:
+				t.pen.attr |= attrBold
+			case n == 2:
+				t.pen.attr |= attrDim
+			case n == 3:
+				t.pen.attr |= attrItalic
+			case n == 4:
+				if len(sub) > 1 && num(sub[1]) == 0 { // 4:0 is no underline
+					t.pen.attr &^= attrUnderline
+				} else {
+					t.pen.attr |= attrUnderline
+				}
+			case n == 5 || n == 6:
+				t.pen.attr |= attrBlink
+			case n == 7:
+				t.pen.attr |= attrReverse
+			case n == 8:
+				t.pen.attr |= attrHidden
+			case n == 9:
+				t.pen.attr |= attrStrike
+			case n == 21:
+				t.pen.attr |= attrUnderline
+			case n == 22:
+				t.pen.attr &^= attrBold | attrDim
+			case n == 23:
+				t.pen.attr &^= attrItalic
+			case n == 24:
+				t.pen.attr &^= attrUnderline
+			case n == 25:
+				t.pen.attr &^= attrBlink
+			case n == 27:
+				t.pen.attr &^= attrReverse
+			case n == 28:
+				t.pen.attr &^= attrHidden
+			case n == 29:
+				t.pen.attr &^= attrStrike
+			case n >= 30 && n <= 37:
+				t.pen.fg = colIndexed | tcolor(n-30)
+			case n == 39:
+				t.pen.fg = colDefault
+			case n >= 40 && n <= 47:
+				t.pen.bg = colIndexed | tcolor(n-40)
+			case n == 49:
+				t.pen.bg = colDefault
+			case n >= 90 && n <= 97:
+				t.pen.fg = colIndexed | tcolor(n-90+8)
+			case n >= 100 && n <= 107:
+				t.pen.bg = colIndexed | tcolor(n-100+8)
+			case n == 38 || n == 48:
+				var c tcolor
+				if len(sub) > 1 {
+					c, _ = extColor (sub[1:], true)
+				} else {
+					var used int
+					c, used = extColor (fields[i+1:], false)
+					i += used
+				}
+				if n == 38 {
+					t.pen.fg = c
+				} else {
+					t.pen.bg = c
+				}
+		}
+	}
+}
+
+// strings.Split, but into dst so the slice can be reused
+func splitInto (dst []string, s string, sep byte) []string {
+	for {
+		i := strings.IndexByte(s, sep)
+		if i < 0 {
+			return append(dst, s)
+		}
+		dst = append(dst, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// parse the args after a 38/48, returns the color and how many args it took.
+// colon separated truecolor may have a color space id before r, g and b
+func extColor (args []string, colon bool) (tcolor, int) {
+	if len(args) == 0 {
+		return colDefault, 0
+	}
+	switch num(args[0]) {
+		case 5:
+			if len(args) < 2 {
+				return colDefault, len(args)
+			}
+			return colIndexed | tcolor(num(args[1])&0xff), 2
+		case 2:
+			rgb := args[1:]
+			if colon && len(rgb) >= 4 {
+				rgb = rgb[1:]
+			}
+			if len(rgb) < 3 {
+				return colDefault, len(args)
+			}
+			r, g, b := num(rgb[0])&0xff, num(rgb[1])&0xff, num(rgb[2])&0xff
+			return colRGB | tcolor(r<<16|g<<8|b), 4
+	}
+	return colDefault, 1
+}
+
+// a parameter as an int, anything that isn't a number is 0
+func num (s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// split the parameter bytes of the current CSI sequence into ints, a missing
+// param comes back as 0. sub-parameters after a ':' are dropped
+func (t *term) params() []int {
+	if len(t.pbuf) == 0 {
+		return nil
+	}
+	ps := t.pv[:0]
+	n, sub := 0, false
+	for _, c := range t.pbuf {
+		switch {
+			case c == ';':
+				ps = append(ps, n)
+				n, sub = 0, false
+			case c == ':':
+				sub = true
+			case sub:
+			case c >= '0' && c <= '9':
+				n = min(n*10 + int(c-'0'), 65535)
+		}
+	}
+	ps = append(ps, n)
+	t.pv = ps
+	return ps
+}
+
+// ~~~~~~~~~~~~~~~~
+// screen updating
+// ~~~~~~~~~~~~~~~~
+
+func (t *term) print (r rune) {
+	if t.gsets[t.gl] {
+		r = decGraphics(r)
+	}
+	// runes below U+0300 always start a new grapheme, anything past that might
+	// be a combining mark, zwj, skin tone, etc that goes with the last one
+	if r >= 0x300 && t.joinLast(r) {
+		return
+	}
+	w := runewidth.RuneWidth(r)
+	if w == 0 { // zero width with nothing to attach to
+		return
+	}
+	if t.wrapNext && t.autowrap {
+		t.lines[t.curY].wrap = true
+		t.curX = 0
+		t.lineFeed()
+	}
+	if w == 2 && t.curX == t.cols-1 { // a wide rune doesn't fit in the last column
+		if t.cols < 2 {
+			return
+		}
+		if t.autowrap {
+			t.setCell(t.curX, t.curY, t.blank())
+			t.lines[t.curY].wrap = true
+			t.curX = 0
+			t.lineFeed()
+		} else {
+			t.curX--
+		}
+	}
+	if t.insert {
+		t.insertBlanks(w)
+	}
+	c := t.pen
+	c.rn = r
+	if w == 2 {
+		// right half first, so blanking out whatever it lands on can't take out the left half
+		tail := t.pen
+		tail.rn = ' '
+		tail.wide = wideR
+		t.setCell(t.curX+1, t.curY, tail)
+		c.wide = wideL
+	}
+	t.setCell(t.curX, t.curY, c)
+	t.lastRn = r
+	t.lastX, t.lastY = t.curX, t.curY
+	if t.curX+w >= t.cols {
+		t.curX = t.cols-1
+		t.wrapNext = true
+	} else {
+		t.curX += w
+	}
+}
+
+// put c in a cell, blanking out the other half of any wide rune it lands on
+func (t *term) setCell (x, y int, c cell) {
+	cs := t.lines[y].cells
+	switch {
+		case cs[x].wide == wideR && x > 0:
+			cs[x-1] = t.blank()
+		case cs[x].wide == wideL && x+1 < len(cs):
+			cs[x+1] = t.blank()
+	}
+	cs[x] = c
+}
+
+// add r on to the grapheme cluster in the last printed cell if it belongs
+// there and nothing has moved the cursor since, true if it was added
+func (t *term) joinLast (r rune) bool {
+	if t.lastRn == 0 || t.lastY >= t.rows || t.lastX >= t.cols {
+		return false
+	}
+	cs := t.lines[t.lastY].cells
+	c := cs[t.lastX]
+	lw := 1
+	if c.wide == wideL {
+		lw = 2
+	}
+	// the cursor has to be right after the last cell, or waiting to wrap from it
+	after := t.curY == t.lastY &&
+		((!t.wrapNext && t.curX == t.lastX+lw) || (t.wrapNext && t.lastX+lw == t.cols))
+	if !after {
+		return false
+	}
+	tail := c.comb.String()
+	joined := string(c.rn) + tail + string(r)
+	if _, rest, _, _ := uniseg.FirstGraphemeClusterInString(joined, -1); rest != "" {
+		return false
+	}
+	// a cluster only gets so long, past that r still belongs to it but is
+	// dropped like xterm drops combining marks past its limit. otherwise a
+	// long run of marks makes every one after it slower to join than the last
+	if len(tail) + utf8.RuneLen(r) > combMax {
+		return true
+	}
+	// the cluster can turn wide, like a heart picking up an emoji variation selector
+	widens := c.wide == single && uniseg.StringWidth(joined) == 2
+	if widens && t.lastX+1 >= t.cols {
+		return true // no room to widen it in the last column, drop r and keep it narrow
+	}
+	c.comb = toComb (tail + string(r))
+	if widens {
+		right := c
+		right.rn, right.comb, right.wide = ' ', comb{}, wideR
+		t.setCell(t.lastX+1, t.lastY, right)
+		c.wide = wideL
+		if t.curX+1 >= t.cols {
+			t.curX = t.cols-1
+			t.wrapNext = true
+		} else {
+			t.curX++
+		}
+	}
+	cs[t.lastX] = c
+	return true
+}
+
+// move the cursor down a line, scrolling the region if it's on the bottom margin
+func (t *term) lineFeed() {
+	t.wrapNext = false
+	if t.curY == t.bot {
+		t.scrollUp(t.top, t.bot, 1)
+	} else if t.curY < t.rows-1 {
+		t.curY++
+	}
+}
+
+func (t *term) reverseIndex() {
+	t.wrapNext = false
+	if t.curY == t.top {
+		t.scrollDown(t.top, t.bot, 1)
+	} else if t.curY > 0 {
+		t.curY--
+	}
+}
+
+// scroll rows top through bot (inclusive) up by n, blank rows come in at the bottom.
+// rows scrolling off the very top of the primary screen go into the scrollback
+func (t *term) scrollUp (top, bot, n int) {
+	if n > bot-top+1 {
+		n = bot-top+1
+	}
+	// the rows going off the top get reused for the blank ones, or the rows
+	// they push out of the scrollback do if they're kept
+	gone := append(t.gone[:0], t.lines[top:top+n]...)
+	if top == 0 && !t.onAlt {
+		for i, l := range gone {
+			gone[i] = t.pushScrollback(l)
+		}
+	}
+	copy(t.lines[top:bot+1], t.lines[top+n:bot+1])
+	for i := bot-n+1; i <= bot; i++ {
+		t.lines[i] = t.reuseLine(gone[i-(bot-n+1)])
+	}
+	t.gone = gone[:0]
+}
+
+// scroll rows top through bot (inclusive) down by n, blank rows come in at the top
+func (t *term) scrollDown (top, bot, n int) {
+	if n > bot-top+1 {
+		n = bot-top+1
+	}
+	gone := append(t.gone[:0], t.lines[bot+1-n:bot+1]...)
+	copy(t.lines[top+n:bot+1], t.lines[top:bot+1-n])
+	for i := top; i < top+n; i++ {
+		t.lines[i] = t.reuseLine(gone[i-top])
+	}
+	t.gone = gone[:0]
+}
+
+// blank the cells from column x0 up to (not including) x1 on row y
+func (t *term) clearCells (y, x0, x1 int) {
+	x0, x1 = max(x0, 0), min(x1, t.cols)
+	for x := x0; x < x1; x++ {
+		t.lines[y].cells[x] = t.blank()
+	}
+}
+
+func (t *term) eraseLine (mode int) {
+	t.wrapNext = false
+	switch mode {
+		case 0:
+			t.clearCells(t.curY, t.curX, t.cols)
+			t.lines[t.curY].wrap = false
+		case 1:
+			t.clearCells(t.curY, 0, t.curX+1)
+		case 2:
+			t.clearCells(t.curY, 0, t.cols)
+			t.lines[t.curY].wrap = false
+	}
+}
+
+func (t *term) eraseDisplay (mode int) {
+	t.wrapNext = false
+	switch mode {
+		case 0:
+			t.eraseLine(0)
+			for y := t.curY+1; y < t.rows; y++ {
+				t.lines[y] = t.blankLine()
+			}
+		case 1:
+			t.eraseLine(1)
+			for y := 0; y < t.curY; y++ {
+				t.lines[y] = t.blankLine()
+			}
+		case 2:
+			for y := range t.lines {
+				t.lines[y] = t.blankLine()
+			}
+		case 3:
+			t.sb.clear()
+			t.scroll = 0
+	}
+}
+
+func (t *term) insertBlanks (n int) {
+	t.wrapNext = false
+	cs := t.lines[t.curY].cells
+	n = min(n, t.cols-t.curX)
+	copy(cs[t.curX+n:], cs[t.curX:])
+	t.clearCells(t.curY, t.curX, t.curX+n)
+}
+
+func (t *term) deleteChars (n int) {
+	t.wrapNext = false
+	cs := t.lines[t.curY].cells
+	n = min(n, t.cols-t.curX)
+	copy(cs[t.curX:], cs[t.curX+n:])
+	t.clearCells(t.curY, t.cols-n, t.cols)
+}
+
+func (t *term) tabForward (n int) {
+	t.wrapNext = false
+	for ; n > 0 && t.curX < t.cols-1; n-- {
+		t.curX++
+		for t.curX < t.cols-1 && !t.tabs[t.curX] {
+			t.curX++
+		}
+	}
+}
+
+func (t *term) tabBackward (n int) {
+	t.wrapNext = false
+	for ; n > 0 && t.curX > 0; n-- {
+		t.curX--
+		for t.curX > 0 && !t.tabs[t.curX] {
+			t.curX--
+		}
+	}
+}
+
+// ~~~~~~~~~~~~~~~
+// cursor motion
+// ~~~~~~~~~~~~~~~
+
+// put the cursor at x, y clamped to the screen
+func (t *term) setCur (x, y int) {
+	t.wrapNext = false
+	t.curX = min(max(x, 0), t.cols-1)
+	t.curY = min(max(y, 0), t.rows-1)
+}
+
+// like setCur but y is relative to the scrolling region in origin mode (CUP/VPA)
+func (t *term) moveTo (x, y int) {
+	if t.origin {
+		t.setCur(x, min(y+t.top, t.bot))
+	} else {
+		t.setCur(x, y)
+	}
+}
+
+// the furthest up CUU can move the cursor from where it is
+func (t *term) upperBound() int {
+	if t.curY >= t.top {
+		return t.top
+	}
+	return 0
+}
+
+// the furthest down CUD can move the cursor from where it is
+func (t *term) lowerBound() int {
+	if t.curY <= t.bot {
+		return t.bot
+	}
+	return t.rows-1
+}
+
+func (t *term) saveCur() {
+	t.saved = savedCur {
+		x        : t.curX,
+		y        : t.curY,
+		pen      : t.pen,
+		wrapNext : t.wrapNext,
+		origin   : t.origin,
+		gsets    : t.gsets,
+		gl       : t.gl,
+	}
+}
+
+func (t *term) restoreCur() {
+	s := t.saved
+	t.setCur(s.x, s.y)
+	t.pen = s.pen
+	t.wrapNext = s.wrapNext
+	t.origin = s.origin
+	t.gsets = s.gsets
+	t.gl = s.gl
+}
+
+// map a rune through the DEC special graphics set, which is what ESC ( 0 switches to
+func decGraphics (r rune) rune {
+	if r < 0x5f || r > 0x7e {
+		return r
+	}
+	return []rune(" ◆▒␉␌␍␊°±␤␋┘┐┌└┼⎺⎻─⎼⎽├┤┴┬│≤≥π≠£·")[r-0x5f]
+}
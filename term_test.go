@@ -0,0 +1,313 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// the rows of t as plain text, without the blank cells off the right of them
+func screenStr (t *term) []string {
+	rows := make([]string, t.rows)
+	for y := range rows {
+		rows[y] = strings.TrimRight(t.lineStr(y), " ")
+	}
+	return rows
+}
+
+func TestTermWrite (t *testing.T) {
+	tests := []struct {
+		name       string
+		rows, cols int
+		in         string
+		want       []string
+		x, y       int // where the cursor should end up
+	}{
+		{"plain", 3, 10, "hi", []string { "hi", "", "" }, 2, 0},
+		{"newline", 3, 10, "ab\r\ncd", []string { "ab", "cd", "" }, 2, 1},
+		{"cup", 3, 10, "\x1b[2;4HX", []string { "", "   X", "" }, 4, 1},
+		{"cup clamps", 3, 10, "\x1b[9;99HX", []string { "", "", "         X" }, 9, 2},
+		{"relative moves", 3, 10, "\x1b[2;5H\x1b[AU\x1b[2BD\x1b[3DL\x1b[2CR",
+			[]string { "    U", "", "   L DR" }, 7, 2},
+		{"cha and vpa", 3, 10, "\x1b[7GX\x1b[3dY", []string { "      X", "", "       Y" }, 8, 2},
+		{"backspace and tab", 3, 20, "abc\bX\tY", []string { "abX     Y", "", "" }, 9, 0},
+		{"erase to end of line", 2, 10, "hello\x1b[1;3H\x1b[K", []string { "he", "" }, 2, 0},
+		{"erase to start of line", 2, 10, "hello\x1b[1;3H\x1b[1K", []string { "   lo", "" }, 2, 0},
+		{"erase screen", 2, 10, "ab\r\ncd\x1b[2J", []string { "", "" }, 2, 1},
+		{"erase below", 3, 10, "ab\r\ncd\r\nef\x1b[2;2H\x1b[J", []string { "ab", "c", "" }, 1, 1},
+		{"erase chars", 1, 10, "abcdef\x1b[1;2H\x1b[3X", []string { "a   ef" }, 1, 0},
+		{"insert and delete chars", 1, 10, "abcdef\x1b[1;2H\x1b[2P\x1b[1@", []string { "a def" }, 1, 0},
+		{"autowrap", 3, 5, "abcdefg", []string { "abcde", "fg", "" }, 2, 1},
+		{"wrap waits for the next rune", 3, 5, "abcde", []string { "abcde", "", "" }, 4, 0},
+		{"no autowrap", 2, 5, "\x1b[?7labcdefg", []string { "abcdg", "" }, 4, 0},
+		{"scrolls at the bottom", 2, 5, "a\r\nb\r\nc", []string { "b", "c" }, 1, 1},
+		{"wide", 1, 10, "a世b", []string { "a世b" }, 4, 0},
+		{"wide wraps whole", 2, 4, "abc世", []string { "abc", "世" }, 2, 1},
+		{"combining", 1, 10, "éx", []string { "éx" }, 2, 0},
+		{"zwj sequence", 1, 10, "👩‍💻x", []string { "👩‍💻x" }, 3, 0},
+		{"family zwj sequence", 1, 10, "👨‍👩‍👧‍👦x", []string { "👨‍👩‍👧‍👦x" }, 3, 0},
+		{"combining marks past combMax are dropped", 1, 10, "e" + strings.Repeat("\u0301", 5000) + "x",
+			[]string { "e" + strings.Repeat("\u0301", combMax/2) + "x" }, 2, 0},
+		{"scroll region", 4, 5, "top\x1b[2;3r\x1b[3;1Ha\r\nb\r\nc\x1b[r",
+			[]string { "top", "b", "c", "" }, 0, 0}, // resetting the region homes the cursor
+	}
+	for _, tc := range tests {
+		tm := newTerm (tc.rows, tc.cols)
+		tm.write([]byte(tc.in))
+		if got := screenStr (tm); strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: screen is %q, want %q", tc.name, got, tc.want)
+		}
+		if tm.curX != tc.x || tm.curY != tc.y {
+			t.Errorf("%s: cursor at %d,%d, want %d,%d", tc.name, tm.curX, tm.curY, tc.x, tc.y)
+		}
+	}
+}
+
+func TestTermReflow (t *testing.T) {
+	tests := []struct {
+		name       string
+		rows, cols int
+		in         string
+		toRows     int
+		toCols     int
+		want       []string
+		x, y       int
+	}{
+		{"shrink", 4, 10, "0123456789abcde", 4, 5,
+			[]string { "01234", "56789", "abcde", "" }, 0, 3},
+		{"grow", 4, 10, "0123456789abcde", 4, 20,
+			[]string { "0123456789abcde", "", "", "" }, 15, 0},
+		{"hard newlines stay", 3, 10, "abc\r\ndef", 3, 2,
+			[]string { "c", "de", "f" }, 1, 2}, // "ab" goes into the scrollback
+		{"wide runes don't split", 2, 6, "ab世界", 3, 3,
+			[]string { "ab", "世", "界" }, 1, 2},
+		{"fewer rows keeps the cursor", 4, 10, "a\r\nb\r\nc", 2, 10,
+			[]string { "b", "c" }, 1, 1},
+		{"more rows pulls the scrollback back", 2, 10, "a\r\nb\r\nc", 3, 10,
+			[]string { "a", "b", "c" }, 1, 2},
+	}
+	for _, tc := range tests {
+		tm := newTerm (tc.rows, tc.cols)
+		tm.write([]byte(tc.in))
+		tm.resize(tc.toRows, tc.toCols)
+		if got := screenStr (tm); strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%s: screen is %q, want %q", tc.name, got, tc.want)
+		}
+		if tm.curX != tc.x || tm.curY != tc.y {
+			t.Errorf("%s: cursor at %d,%d, want %d,%d", tc.name, tm.curX, tm.curY, tc.x, tc.y)
+		}
+	}
+	// shrinking and growing back gives the same screen
+	tm := newTerm (3, 10)
+	tm.write([]byte("0123456789abc\r\nxyz"))
+	before := screenStr (tm)
+	tm.resize(3, 4)
+	tm.resize(3, 10)
+	if got := screenStr (tm); strings.Join(got, "|") != strings.Join(before, "|") {
+		t.Errorf("round trip: screen is %q, want %q", got, before)
+	}
+}
+
+func TestTermAltScreen (t *testing.T) {
+	tm := newTerm (3, 10)
+	tm.write([]byte("main\r\nsecond"))
+	tm.write([]byte("\x1b[?1049h"))
+	if !tm.onAlt {
+		t.Fatal("1049h didn't switch to the alternate screen")
+	}
+	if got := screenStr (tm); strings.Join(got, "") != "" {
+		t.Errorf("alternate screen isn't clear: %q", got)
+	}
+	tm.write([]byte("\x1b[Halt"))
+	tm.write([]byte("\x1b[?1049l"))
+	if tm.onAlt {
+		t.Fatal("1049l didn't switch back")
+	}
+	if got := screenStr (tm); strings.Join(got, "|") != "main|second|" {
+		t.Errorf("primary screen is %q after leaving the alternate one", got)
+	}
+	if tm.curX != 6 || tm.curY != 1 {
+		t.Errorf("cursor at %d,%d, want it restored to 6,1", tm.curX, tm.curY)
+	}
+	// nothing on the alternate screen goes in the scrollback
+	tm = newTerm (2, 10)
+	tm.write([]byte("\x1b[?1049ha\r\nb\r\nc\r\nd"))
+	if tm.sb.n != 0 {
+		t.Errorf("alternate screen scrolled %d rows into the scrollback", tm.sb.n)
+	}
+}
+
+func TestTermSGR (t *testing.T) {
+	tests := []struct {
+		in     string
+		fg, bg tcolor
+		attr   uint16
+	}{
+		{"\x1b[31m", colIndexed|1, colDefault, 0},
+		{"\x1b[92;104m", colIndexed|10, colIndexed|12, 0},
+		{"\x1b[1;4;7m", colDefault, colDefault, attrBold|attrUnderline|attrReverse},
+		{"\x1b[1;31m\x1b[0m", colDefault, colDefault, 0},
+		{"\x1b[1;22m", colDefault, colDefault, 0},
+		{"\x1b[4:0m", colDefault, colDefault, 0},
+		{"\x1b[4:3m", colDefault, colDefault, attrUnderline},
+		{"\x1b[38;5;200m", colIndexed|200, colDefault, 0},
+		{"\x1b[48;5;17m", colDefault, colIndexed|17, 0},
+		{"\x1b[38;2;1;2;3m", colRGB|0x010203, colDefault, 0},
+		{"\x1b[38;2;1;2;3;1m", colRGB|0x010203, colDefault, attrBold},
+		{"\x1b[38:5:200m", colIndexed|200, colDefault, 0},
+		{"\x1b[38:2::1:2:3m", colRGB|0x010203, colDefault, 0},
+		{"\x1b[38:2:1:2:3m", colRGB|0x010203, colDefault, 0},
+		{"\x1b[48:2::255:128:0;1m", colDefault, colRGB|0xff8000, attrBold},
+		{"\x1b[31m\x1b[39m", colDefault, colDefault, 0},
+	}
+	for _, tc := range tests {
+		tm := newTerm (1, 10)
+		tm.write([]byte(tc.in + "x"))
+		c := tm.lines[0].cells[0]
+		if c.fg != tc.fg || c.bg != tc.bg || c.attr != tc.attr {
+			t.Errorf("%q: got fg %#x bg %#x attr %#x, want fg %#x bg %#x attr %#x",
+				tc.in, c.fg, c.bg, c.attr, tc.fg, tc.bg, tc.attr)
+		}
+	}
+}
+
+func TestTermReplies (t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"DA1", "\x1b[c", "\x1b[?62;22c"},
+		{"DA2", "\x1b[>c", "\x1b[>1;10;0c"},
+		{"DSR", "\x1b[5n", "\x1b[0n"},
+		{"CPR", "\x1b[3;7H\x1b[6n", "\x1b[3;7R"},
+		{"CPR with origin mode", "\x1b[2;4r\x1b[?6h\x1b[2;3H\x1b[6n", "\x1b[2;3R"},
+		{"DECXCPR", "ab\x1b[?6n", "\x1b[?1;3;1R"},
+		{"DECRQM set", "\x1b[?7$p", "\x1b[?7;1$y"},
+		{"DECRQM reset", "\x1b[?1049$p", "\x1b[?1049;2$y"},
+		{"DECRQM after setting", "\x1b[?2004h\x1b[?2004$p", "\x1b[?2004;1$y"},
+		{"DECRQM unknown", "\x1b[?9999$p", "\x1b[?9999;0$y"},
+		{"DECRQM ansi", "\x1b[4h\x1b[4$p", "\x1b[4;1$y"},
+		{"XTWINOPS 18", "\x1b[18t", "\x1b[8;5;20t"},
+		{"XTWINOPS 19", "\x1b[19t", "\x1b[9;5;20t"},
+	}
+	for _, tc := range tests {
+		tm := newTerm (5, 20)
+		tm.write([]byte(tc.in))
+		if got := string(tm.reply); got != tc.want {
+			t.Errorf("%s: replied %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// output like ls --color prints, a screenful many times over
+func lsOutput() []byte {
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		b.WriteString("\x1b[0m\x1b[01;34mdirectory\x1b[0m  \x1b[01;32mscript.sh\x1b[0m  notes.txt  \x1b[01;36mlink\x1b[0m  \x1b[00;31marchive.tar.gz\x1b[0m  README.md\r\n")
+	}
+	return []byte(b.String())
+}
+
+// a big window getting scrolled through, this should stay at tens of MB/s
+func BenchmarkTermWrite (b *testing.B) {
+	out := lsOutput()
+	t := newTerm (50, 200)
+	b.SetBytes(int64(len(out)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.write(out)
+	}
+}
+
+func TestTermTitle (t *testing.T) {
+	long := strings.Repeat("x", maxTitle+10)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"osc 0", "\x1b]0;hello\a", "hello"},
+		{"osc 2", "\x1b]2;hi there\a", "hi there"},
+		{"ended by ST", "\x1b]2;st\x1b\\", "st"},
+		{"osc 1 is only the icon", "\x1b]1;icon\a", ""},
+		{"last one wins", "\x1b]2;one\a\x1b]0;two\a", "two"},
+		{"no control characters", "\x1b]2;a\x7fb\a", "ab"},
+		{"cut short", "\x1b]2;" + long + "\a", long[:maxTitle]},
+		{"push and pop", "\x1b]2;one\a\x1b[22t\x1b]2;two\a\x1b[23t", "one"},
+		{"push and pop the title only", "\x1b]2;one\a\x1b[22;2t\x1b]2;two\a\x1b[23;2t", "one"},
+		{"icon name isn't pushed", "\x1b]2;one\a\x1b[22;1t\x1b]2;two\a\x1b[23;1t", "two"},
+		{"nested", "\x1b]2;a\a\x1b[22t\x1b]2;b\a\x1b[22t\x1b]2;c\a\x1b[23t\x1b[23t", "a"},
+		{"pop with nothing pushed", "\x1b]2;x\a\x1b[23t", "x"},
+	}
+	for _, tc := range tests {
+		tm := newTerm (2, 10)
+		tm.write([]byte(tc.in))
+		if tm.title != tc.want {
+			t.Errorf("%s: title is %q, want %q", tc.name, tm.title, tc.want)
+		}
+	}
+	// the stack doesn't grow forever
+	tm := newTerm (2, 10)
+	tm.write([]byte(strings.Repeat("\x1b[22t", maxTitles*2)))
+	if len(tm.titles) != maxTitles {
+		t.Errorf("title stack is %d deep, want %d", len(tm.titles), maxTitles)
+	}
+}
+
+func TestTermClipboard (t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []clipReq
+	}{
+		{"set", "\x1b]52;c;aGVsbG8=\a", []clipReq { { sel: "c", data: []byte("hello") } }},
+		{"ended by ST", "\x1b]52;p;aGk=\x1b\\", []clipReq { { sel: "p", data: []byte("hi") } }},
+		{"selection defaults to s0", "\x1b]52;;aGk=\a", []clipReq { { sel: "s0", data: []byte("hi") } }},
+		{"query", "\x1b]52;c;?\a", []clipReq { { sel: "c", query: true } }},
+		{"invalid base64 clears it", "\x1b]52;c;!!!\a", []clipReq { { sel: "c" } }},
+		{"empty clears it", "\x1b]52;c;\a", []clipReq { { sel: "c" } }},
+		{"no data at all", "\x1b]52;c\a", nil},
+		{"more than one", "\x1b]52;c;YQ==\a\x1b]52;c;?\a",
+			[]clipReq { { sel: "c", data: []byte("a") }, { sel: "c", query: true } }},
+	}
+	for _, tc := range tests {
+		tm := newTerm (2, 10)
+		tm.write([]byte(tc.in))
+		if len(tm.clips) != len(tc.want) {
+			t.Errorf("%s: got %d requests, want %d", tc.name, len(tm.clips), len(tc.want))
+			continue
+		}
+		for i, got := range tm.clips {
+			want := tc.want[i]
+			if got.sel != want.sel || got.query != want.query || string(got.data) != string(want.data) {
+				t.Errorf("%s: request %d is %+v, want %+v", tc.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestTermCwd (t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no host", "\x1b]7;file:///tmp/dir\a", "/tmp/dir"},
+		{"localhost", "\x1b]7;file://localhost/tmp/dir\a", "/tmp/dir"},
+		{"this machine", "\x1b]7;file://" + hostname + "/tmp/dir\x1b\\", "/tmp/dir"},
+		{"escaped", "\x1b]7;file:///tmp/a%20b\a", "/tmp/a b"},
+		{"some other machine", "\x1b]7;file://not-" + hostname + "/tmp/dir\a", ""},
+		{"not a file url", "\x1b]7;http://localhost/tmp\a", ""},
+		{"no path", "\x1b]7;file://localhost\a", ""},
+		{"not a url", "\x1b]7;%zz\a", ""},
+		{"later one wins", "\x1b]7;file:///a\a\x1b]7;file:///b\a", "/b"},
+		{"a remote one doesn't clear it", "\x1b]7;file:///a\a\x1b]7;file://elsewhere.invalid/b\a", "/a"},
+	}
+	for _, tc := range tests {
+		tm := newTerm (2, 10)
+		tm.write([]byte(tc.in))
+		if tm.cwd != tc.want {
+			t.Errorf("%s: cwd is %q, want %q", tc.name, tm.cwd, tc.want)
+		}
+	}
+}
@@ -1,20 +1,24 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"time"
 	"strings"
+	"syscall"
 	//"slices"
-	"bufio"
-	//"io"
-	"unicode"
+	"io"
+	"unicode/utf8"
 
 	// "github.com/charmbracelet/lipgloss"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/creack/pty"
+	"github.com/muesli/termenv"
+	"golang.org/x/sys/unix"
 )
 
 // ~~~~~~~~~~
@@ -34,12 +38,25 @@ type model struct {
 	currY   int // y coord.  should be curX/curY, but currY is tasty
 	action  action // does wask move cursor, move a window, or resize a window
 	gtxtin  textinput.Model // global text input
+	clip    string // the last thing a window put on the clipboard
+	clipAsks []pendingClip // clipboard requests waiting on alt+y/alt+k from the user
+	drag    *drag // window being moved or resized with the mouse, if there is one
+	pasting bool // in the middle of a bracketed paste from the host terminal
+	paste   []byte // what's been pasted so far
+	focus   uint // id of the focused window
+	focused bool // whether any window has focus
+	switcher bool // whether the alt+tab switcher is up
+	swSel   int // which row of the switcher is picked
+	prompt  prompt // what gtxtin is being used for
+	note    string // something to tell the user, it goes away with the next key
+	layout  string // layout file to open at startup, from --layout
 }
 
 type window struct {
 	id    uint // unique id
-	name  string // name
-	cont  []string // contents
+	name  string // name given with alt+c
+	lockName bool // show name even if the program sets a title
+	term  *term // terminal emulator holding the window's contents
 	onWS  byte // byte of workspaces it's visible on
 	top   int // index of top border
 	lines uint16 // how many lines to give the window
@@ -48,14 +65,50 @@ type window struct {
 	pty   *os.File // pointer to pty
 	cmd   *exec.Cmd // pointer to the running shell
 	msgch chan PtyMsg // channel for PtyMsg from this pty
+	done  chan struct{} // closed once the process has been reaped
+	exited bool // whether the process has exited and the window is just hanging around
+	stat  string // how the process exited
+	urgent bool // rang the bell while the user wasn't looking at it
+	flash bool // border is flashing for a visual bell
+	rec   *recorder // where the window's output is being recorded to, nil if it isn't
+	play  *player // the recording being played back in it, these windows have no pty or process
 }
 
+// what a bell from a window looks like
+type bellStyle int
+
+const (
+	bellNone bellStyle = iota
+	bellVisual // flash the window's border
+)
+
+// what to do with a window once its process exits
+type exitPolicy int
+
+const (
+	closeNever exitPolicy = iota // keep it around showing how it exited
+	closeClean // close it if it exited with code 0, keep it otherwise
+	closeAlways
+)
+
+// what gtxtin is asking for
+type prompt int
+
+const (
+	promptName prompt = iota // a name for the focused window
+	promptSave // a file to save the layout to
+	promptLoad // a layout file to open
+	promptRec // a file to record the focused window to
+	promptPlay // a cast file to play back
+)
+
 type action int
 
 const (
 	cursor action = iota
 	move
 	resize
+	scroll
 )
 
 func strAct (a action) string {
@@ -63,6 +116,7 @@ func strAct (a action) string {
 		case cursor: return "cursor"
 		case move:   return "move"
 		case resize: return "resize"
+		case scroll: return "scroll"
 	}
 	return ""
 }
@@ -86,32 +140,171 @@ func initialModel() model {
 	}
 }
 
-// msg for when to write a new rune to a window
+// msg for when a window's pty has output for it
 type PtyMsg struct {
-	id uint
-	rn rune
+	id   uint
+	data []byte // a chunk of output, always ends on a whole utf-8 sequence
+	ch   chan PtyMsg // the channel it came through, so the right one gets listened to again
+}
+
+// msg for when the process running in a window has exited
+type ExitMsg struct {
+	id   uint
+	cmd  *exec.Cmd // the process that exited, a respawned window will have a new one
+	code int // exit code, -1 if it was killed by a signal
+	stat string // how it went out, for showing in the border
 }
 
+// read chunks out of the pty until it errors out, which happens once every
+// process holding the other end has exited or the pty has been closed
 func listenForPtyMsg (wid uint, ch chan PtyMsg, pty *os.File) tea.Cmd {
 	return func() tea.Msg {
-		reader := bufio.NewReader(pty)
+		defer close(ch) // lets waitForPtyMsg know there's nothing left
+		buf := make([]byte, readSize)
+		held := 0 // bytes of a split up utf-8 sequence left at the front of buf from last time
 		for {
-			r, _, err := reader.ReadRune()
-			if err == nil { // TODO: actually deal with an error
-				pmsg := PtyMsg {
-					id: wid,
-					rn: r,
-				}
-				ch <- pmsg
+			n, err := pty.Read(buf[held:])
+			if err != nil {
+				return nil
+			}
+			n += held
+			// don't send half a rune, hold on to it until the rest shows up
+			end := utf8Boundary (buf[:n])
+			data := make([]byte, end)
+			copy(data, buf[:end])
+			held = copy(buf, buf[end:n])
+			ch <- PtyMsg {
+				id:   wid,
+				data: data,
+				ch:   ch,
 			}
 		}
 	}
 }
 
-func waitForPtyMsg (ch chan PtyMsg) tea.Cmd {
+// wait for the next chunk from a pty, but don't hand it over before next
+// so a window spewing output doesn't get the screen redrawn more than maxFPS
+// times a second. whatever piles up in the meantime gets drained all at once
+func waitForPtyMsg (ch chan PtyMsg, next time.Time) tea.Cmd {
 	return func() tea.Msg {
-		return <- ch
+		pmsg, ok := <- ch
+		if !ok { // the reader is done, stop listening
+			return nil
+		}
+		time.Sleep(time.Until(next))
+		return pmsg
+	}
+}
+
+// length of the front of b that ends on a complete utf-8 sequence. anything
+// after that is the start of a rune that got cut off by the read
+func utf8Boundary (b []byte) int {
+	// a rune is at most 4 bytes so only the last 3 can be the start of a partial one
+	for i := len(b)-1; i >= 0 && i >= len(b)-3; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
 	}
+	return len(b)
+}
+
+// reap the window's process once it exits, done gets closed so anything
+// waiting on the process to go away (like closeWin) knows
+func waitForExit (wid uint, c *exec.Cmd, done chan struct{}) tea.Cmd {
+	return func() tea.Msg {
+		c.Wait()
+		close(done)
+		stat := fmt.Sprintf("exited (code %d)", c.ProcessState.ExitCode())
+		if ws, ok := c.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			stat = fmt.Sprintf("killed (%s)", ws.Signal())
+		}
+		return ExitMsg {
+			id:   wid,
+			cmd:  c,
+			code: c.ProcessState.ExitCode(),
+			stat: stat,
+		}
+	}
+}
+
+// start argv in dir on a new pty sized to the window and hook it up to
+// the window, returns the cmds that need to be run to listen to it
+func spawn (w *window, argv []string, dir string) (tea.Cmd, error) {
+	wsz := pty.Winsize {
+		Rows : w.lines,
+		Cols : w.cols,
+	}
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Dir = dir
+	ptmx, err := pty.StartWithSize(c, &wsz) // initialize the pty
+	if err != nil {
+		return nil, err
+	}
+	// make the channel that the PtyMsg for this pty will go through
+	ch := make (chan PtyMsg, ptyBacklog)
+	w.term = newTerm (int(wsz.Rows), int(wsz.Cols))
+	w.pty = ptmx
+	w.cmd = c
+	w.msgch = ch
+	w.done = make(chan struct{})
+	w.exited = false
+	w.stat = ""
+	return tea.Batch (
+		listenForPtyMsg (w.id, ch, ptmx),
+		waitForPtyMsg (ch, time.Now()),
+		waitForExit (w.id, c, w.done),
+	), nil
+}
+
+// shut a window's process down without holding up the ui. closing the pty
+// hangs up the terminal, then the process gets a SIGHUP of its own and
+// killTimeout to go away before it gets a SIGKILL
+func closeWin (w window) tea.Cmd {
+	if w.play != nil {
+		return nil // nothing running in it
+	}
+	return func() tea.Msg {
+		w.rec.stop()
+		w.pty.Close() // also gets the reader goroutine to give up
+		if w.exited {
+			return nil
+		}
+		w.cmd.Process.Signal(syscall.SIGHUP)
+		select {
+			case <- w.done:
+			case <- time.After(killTimeout):
+				w.cmd.Process.Kill()
+		}
+		return nil
+	}
+}
+
+// msg for when a window's visual bell is over
+type BellMsg struct {
+	id uint
+}
+
+// deal with a bell from the window at index i. it's urgent unless it's the
+// focused window on a visible workspace, since then the user can see it
+func ringBell (m *model, i int) tea.Cmd {
+	w := &m.windows[i]
+	if getFocWinInd (*m) != i {
+		w.urgent = true
+	}
+	if bellForward {
+		hostOut.Write([]byte{'\a'})
+	}
+	if bellMode != bellVisual {
+		return nil
+	}
+	w.flash = true
+	id := w.id
+	return tea.Tick(bellFlash, func (time.Time) tea.Msg {
+		return BellMsg { id }
+	})
 }
 
 type TickMsg time.Time
@@ -126,10 +319,20 @@ func (m model) Init() tea.Cmd {
 	return tea.Sequence(
 		tea.EnterAltScreen,
 		tea.SetWindowTitle("ttywm"),
+		hostPaste (true),
+		m.openLayout(), // before the tick, which holds the sequence up until the next second
 		doTick(),
 	)
 }
 
+// load the layout given with --layout, if there was one
+func (m model) openLayout() tea.Cmd {
+	if m.layout == "" {
+		return nil
+	}
+	return loadLayout (m.layout)
+}
+
 func isNewLine(c rune) bool {
 	return c == '\n' || c == '\r'
 }
@@ -142,20 +345,104 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 		case TickMsg:
 			m.dt = time.Time(msg)
+			for _, w := range m.windows {
+				w.rec.flush()
+			}
 			return m, doTick()
 		case PtyMsg:
-			var ch chan PtyMsg
 			for i, w := range m.windows {
-				if w.id == msg.id { // look for the correct window to update
-					if msg.rn == '\n' { // if the rune is a newline
-						m.windows[i].cont = append(w.cont, "") // add a new line to the window's cont
-					} else {
-						w.cont[len(w.cont)-1] += string(msg.rn) // add the rn to the last string in window's cont
+				if w.id == msg.id && w.msgch == msg.ch { // look for the correct window to update
+					w.term.write(msg.data) // run the output through the window's terminal emulator
+					w.rec.output(msg.data)
+					// and whatever else has come in since, so it all goes out in one redraw
+					closed := false
+					for drained := false; !drained; {
+						select {
+							case more, ok := <- msg.ch:
+								if !ok { // the reader's done, but what it sent still needs handling
+									drained, closed = true, true
+									break
+								}
+								w.term.write(more.data)
+								w.rec.output(more.data)
+							default:
+								drained = true
+						}
+					}
+					// answer anything the program asked the terminal
+					if len(w.term.reply) > 0 {
+						w.pty.Write(w.term.reply)
+						w.term.reply = w.term.reply[:0]
 					}
-					ch = w.msgch
+					// and pass clipboard requests on
+					var cmds []tea.Cmd
+					if !closed {
+						cmds = append(cmds, waitForPtyMsg(msg.ch, time.Now().Add(time.Second/maxFPS)))
+					}
+					for _, req := range w.term.clips {
+						cmds = append(cmds, clipRequest (&m, w.id, req))
+					}
+					w.term.clips = nil
+					if w.term.bell {
+						w.term.bell = false
+						cmds = append(cmds, ringBell (&m, i))
+					}
+					return m, tea.Batch(cmds...)
+				}
+			}
+			return m, waitForPtyMsg(msg.ch, time.Now().Add(time.Second/maxFPS))
+		case CastMsg:
+			if msg.err != nil {
+				m.note = fmt.Sprintf("couldn't play %s: %v", msg.path, msg.err)
+				return m, nil
+			}
+			return playWin (m, msg)
+		case PlayMsg:
+			for i := range m.windows {
+				w := &m.windows[i]
+				if w.id == msg.id && w.play != nil && w.play.gen == msg.gen && w.play.pos < len(w.play.events) {
+					playTo (w, w.play.events[w.play.pos].t)
+					return m, nextEvent (*w)
+				}
+			}
+			return m, nil
+		case BellMsg:
+			for i := range m.windows {
+				if m.windows[i].id == msg.id {
+					m.windows[i].flash = false
+				}
+			}
+			return m, nil
+		case LayoutMsg:
+			if msg.err != nil {
+				m.note = fmt.Sprintf("couldn't load layout %s: %v", msg.path, msg.err)
+				return m, nil
+			}
+			return useLayout (m, msg.l)
+		case ProfileMsg: // a session's clients changed
+			colorProfile = termenv.Profile(msg)
+			return m, nil
+		case NoteMsg:
+			m.note = string(msg)
+			return m, nil
+		case ClipMsg:
+			clipReply (m, msg.id, msg.sel, msg.data)
+			return m, nil
+		case ExitMsg:
+			for i, w := range m.windows {
+				if w.id == msg.id && w.cmd == msg.cmd {
+					if closeOnExit == closeAlways || (closeOnExit == closeClean && msg.code == 0) {
+						m.windows = append (m.windows[:i], m.windows[i+1:]...)
+						if m.focused && m.focus == w.id {
+							refocus (&m)
+						}
+						return m, closeWin (w)
+					}
+					m.windows[i].exited = true
+					m.windows[i].stat = msg.stat
 				}
 			}
-			return m, waitForPtyMsg(ch)
+			return m, nil
 		case tea.WindowSizeMsg:
 			m.width = msg.Width
 			m.height = msg.Height
@@ -171,9 +458,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.currY = m.height/2
 			}
 			return m, nil
+		case tea.MouseMsg:
+			return mouseEvent (m, msg)
 		case tea.KeyMsg:
+			if m.pasting { // it's part of a paste, not typing
+				m.paste = append(m.paste, keyBytes (msg, false)...)
+				return m, nil
+			}
+			m.note = ""
+			if len(m.clipAsks) > 0 && !m.gtxtin.Focused() {
+				// a window is waiting to hear if it can use the clipboard. it's
+				// only answered with alt keys, plain ones still go to the window
+				// so typing can't say yes to it by accident
+				switch msg.String() {
+					case "alt+y":
+						return m, answerClip (&m, true)
+					case "alt+k": // alt+n is already new window
+						return m, answerClip (&m, false)
+				}
+			}
+			if m.switcher {
+				return switcherKey (m, msg)
+			}
 			switch msg.String() {
+				case "alt+tab": // pick a window from a list of all of them
+					return openSwitcher (m), nil
 				case "alt+esc":
+					stopRecs (m.windows) // get the last of every recording out before going
 					return m, tea.Quit
 				case "alt+b":
 					if m.bg == len(allBGs) - 1 {
@@ -183,86 +494,56 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+enter":
-					// create a pty.Winsize for the pty
-					wsz := pty.Winsize {  // TODO: pull this out into a const DEF_WSZ
-						Rows : 16,
-						Cols : 65,
-					}
-					// execute bash or whatever shell the user wants
-					c := exec.Command("/bin/bash") // TODO: move this to a const SHELL
-					ptmx, err := pty.StartWithSize(c, &wsz) // initialize the pty
-					// if the pty doesn't initialize just stop here and don't make a window
-					if err != nil {
-						return m, nil // TODO: actually show the error if it comes up
-					}
-					// make the channel that the PtyMsg for this pty will go through
-					ch := make (chan PtyMsg)
-					// create the new window
-					newWin :=
-						window {
-							id    : m.winCt,
-							name  : "",
-							cont  : []string {""}, // make sure cont has atleast 1 line
-							onWS  : m.visWS,
-							top   : m.currY,
-							lines : wsz.Rows,
-							left  : m.currX,
-							cols  : wsz.Cols,
-							pty   : ptmx,
-							cmd   : c,
-							msgch : ch,
+					return newWin (m, "")
+				case "alt+n": // new window in the same directory as the focused one
+					dir := ""
+					if cw := getFocWinInd (m); cw >= 0 {
+						dir = winCwd (m.windows[cw])
+					}
+					return newWin (m, dir)
+				case "alt+u": // jump to the oldest urgent window
+					for i, w := range m.windows {
+						if !w.urgent {
+							continue
 						}
-					m.winCt++ // inc winCt to make sure the next window made has a unique id
-					m.windows = append(m.windows, newWin) // add the window to the top of the stack
-// 					go func (w *window) { // start goroutine to read from the pty
-// 						reader := bufio.NewReader(w.pty) // not sure if this should be in or before goroutine
-// 						max_buffer := uint(w.lines) // TODO: move this into a const
-// 						for !w.kil { // only do this while kil is false
-// 							r, _, err := reader.ReadRune()
-// 							if err != nil {
-// 								if err == io.EOF { // I guess EOF would happen if the pty closes?
-// 									return // I think adding this may close the goroutine whenever
-// 									// the pty closes, if so I can remove the whole kil thing idk
-// 								}// if there's an error that's not pty I'll just append it to
-// 								// the window cont to show until I think of something better
-// 								w.cont = append (w.cont, fmt.Sprint(err))
-// 							}// if there is no error append r to the end of the last string in w.cont
-// 							w.cont[len(w.cont)-1] = w.cont[len(w.cont)-1] + string(r)
-// 							// if r is a newline, also add a new string to w.cont
-// 							if r == '\n' {
-// 								w.cont = append(w.cont, "")
-// 								if uint(len(w.cont)) > max_buffer {// if this new line puts len(w.cont) over max_buffer
-// 									w.cont = w.cont[1:] // pop off the first line
-// 								}
-// 							}
-// 						}
-// 						return // once kil is set to true, close this goroutine
-// 					} (&newWin)
-					return m, tea.Batch (
-						listenForPtyMsg (newWin.id, ch, newWin.pty),
-						waitForPtyMsg (ch),
-					)
-				case "alt+z": // lift window to top of stack
+						w.urgent = false
+						if m.visWS&w.onWS == 0 {
+							m.visWS |= w.onWS // bring a workspace it's on into view
+						}
+						// raise it, focus it and put the cursor in it
+						m.windows = append (m.windows[:i:i], append(m.windows[i+1:], w)...)
+						focusWin (&m, len(m.windows)-1)
+						m.currX = min(max(w.left+1, 0), m.width-1)
+						m.currY = min(max(w.top+1, 0), m.height-1)
+						break
+					}
+					return m, nil
+				case "alt+f": // focus the window under the cursor and lift it, or unfocus
 					cw := getCurWinInd (m)
+					if cw >= 0 {
+						m.windows = append (m.windows[:cw], append(m.windows[cw+1:], m.windows[cw])...)
+						cw = len(m.windows)-1
+					}
+					focusWin (&m, cw)
+					return m, nil
+				case "alt+z": // lift window to top of stack
+					cw := getFocWinInd (m)
 					if cw >= 0 && cw < len(m.windows) -1 {
-						// only adjust stack if there is a window under the cursor
+						// only adjust stack if there is a focused window
 						// and it's not already on top of the stack
 						new := append (m.windows[:cw], append(m.windows[cw+1:], m.windows[cw])...)
 						m.windows = new
 					}
 					return m, nil
 				case "alt+q": // delete window
-					cw := getCurWinInd (m)
+					cw := getFocWinInd (m)
 					if cw >= 0 {
-						// only adjust stack if there is a window under the cursor
-						m.windows[cw].pty.Close() // close the pty
-						m.windows[cw].cmd.Process.Wait() // waits to kill the shell
-						m.windows[cw].cmd.Process.Kill() // kill the shell
-						// TODO: learn why I need to Wait() before killing to avoid leaving a zombie process
-						// also why can't I just Release() after Kill() I know if it works then fine
-						// but I wanted to comment a line as // release the zombie that would've been fun :(
+						// only adjust stack if there is a focused window
+						w := m.windows[cw]
 						new := append (m.windows[:cw], m.windows[cw+1:]...) // remove the window
 						m.windows = new
+						refocus (&m)
+						return m, closeWin (w) // and let the shell go in the background
 					}
 					return m, nil
 				case "alt+w": // cursor up
@@ -271,18 +552,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							if m.currY > 0 {
 								m.currY--
 							}
+							followPointer (&m)
 						case move:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currY > 0 && cw >= 0 {
 								m.windows[cw].top--
 								m.currY--
 							}
 						case resize:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currY > 0 && cw >= 0 && m.windows[cw].lines>2 {
 								m.windows[cw].lines--
+								resizeWin (m.windows[cw])
 								m.currY--
 							}
+						case scroll:
+							if cw := getFocWinInd (m); cw >= 0 {
+								m.windows[cw].term.scrollView(1)
+							}
 					}
 					return m, nil
 				case "alt+s": // cursor down
@@ -291,18 +578,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							if m.currY < m.height - 1 {
 								m.currY++
 							}
+							followPointer (&m)
 						case move:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currY < m.height - 1 && cw >= 0 {
 								m.windows[cw].top++
 								m.currY++
 							}
 						case resize:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currY < m.height - 1 && cw >= 0 {
 								m.windows[cw].lines++
+								resizeWin (m.windows[cw])
 								m.currY++
 							}
+						case scroll:
+							if cw := getFocWinInd (m); cw >= 0 {
+								m.windows[cw].term.scrollView(-1)
+							}
 					}
 					return m, nil
 				case "alt+a": // cursor left
@@ -311,16 +604,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							if m.currX > 0 {
 								m.currX--
 							}
+							followPointer (&m)
 						case move:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currX > 0 && cw >= 0 {
 								m.windows[cw].left--
 								m.currX--
 							}
 						case resize:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currX > 0 && cw >= 0 && m.windows[cw].cols > 2 {
 								m.windows[cw].cols--
+								resizeWin (m.windows[cw])
 								m.currX--
 							}
 					}
@@ -331,16 +626,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							if m.currX < m.width - 1 {
 								m.currX++
 							}
+							followPointer (&m)
 						case move:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currX < m.width - 1 && cw >= 0 {
 								m.windows[cw].left++
 								m.currX++
 							}
 						case resize:
-							cw := getCurWinInd (m)
+							cw := getFocWinInd (m)
 							if m.currX < m.width - 1 && cw >= 0 {
 								m.windows[cw].cols++
+								resizeWin (m.windows[cw])
 								m.currX++
 							}
 					}
@@ -349,7 +646,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if m.action == move {
 						m.action = cursor
 					} else {
-						if getCurWinInd (m) >= 0 {
+						if getFocWinInd (m) >= 0 {
 							m.action = move
 						}
 					}
@@ -358,39 +655,134 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if m.action == resize {
 						m.action = cursor
 					} else {
-						if getCurWinInd (m) >= 0 {
+						if getFocWinInd (m) >= 0 {
 							m.action = resize
 						}
 					}
 					return m, nil
+				case "alt+v": // go to scroll mode
+					if m.action == scroll {
+						m.action = cursor
+						if cw := getFocWinInd (m); cw >= 0 {
+							m.windows[cw].term.scroll = 0
+						}
+					} else {
+						if getFocWinInd (m) >= 0 {
+							m.action = scroll
+						}
+					}
+					return m, nil
 				case "alt+c": // change name of window
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 && !m.gtxtin.Focused(){
 						// only do this if there is a window selected
 						// and m.textin is not already focused
 						// focus text input
 						tfc := m.gtxtin.Focus()
 						// set it to current name
-						m.gtxtin.SetValue(m.windows[winInd].name)
+						m.prompt = promptName
+						m.gtxtin.Prompt = "name: "
+						m.gtxtin.SetValue(winName (m.windows[winInd]))
 						return m, tfc
 					} else {
 						// either theres is no window selected, or textinput is already focused
 						// so just do nothing
 						return m, nil
 					}
+				case "alt+o", "alt+i": // save the layout to a file, or open one
+					if m.gtxtin.Focused() {
+						return m, nil
+					}
+					m.prompt = promptSave
+					m.gtxtin.Prompt = "save layout: "
+					if msg.String() == "alt+i" {
+						m.prompt = promptLoad
+						m.gtxtin.Prompt = "load layout: "
+					}
+					m.gtxtin.SetValue(defaultLayout())
+					return m, m.gtxtin.Focus()
+				case "alt+p": // play back a recording in a new window
+					if m.gtxtin.Focused() {
+						return m, nil
+					}
+					m.prompt = promptPlay
+					m.gtxtin.Prompt = "play: "
+					m.gtxtin.SetValue(recordDir + string(os.PathSeparator))
+					return m, m.gtxtin.Focus()
+				case "alt+t": // record the focused window, or stop recording it
+					winInd := getFocWinInd (m)
+					if winInd < 0 || m.gtxtin.Focused() || m.windows[winInd].play != nil {
+						return m, nil
+					}
+					if w := &m.windows[winInd]; w.rec != nil {
+						if err := w.rec.stop(); err != nil {
+							m.note = fmt.Sprintf("couldn't save recording: %v", err)
+						} else {
+							m.note = "saved recording to " + w.rec.path
+						}
+						w.rec = nil
+						return m, nil
+					}
+					m.prompt = promptRec
+					m.gtxtin.Prompt = "record to: "
+					m.gtxtin.SetValue(defaultCast (m.windows[winInd]))
+					return m, m.gtxtin.Focus()
 				case "enter": // blur active txtinput
 					if m.gtxtin.Focused() { // check if gtxtin is focused
-						winInd := getCurWinInd (m)
-						if winInd >= 0 { // if ther is a selected window, set it's name
-							m.windows[winInd].name = m.gtxtin.Value()
-						}
+						val := m.gtxtin.Value()
 						// either way also reset and blur gtxtin
 						m.gtxtin.Reset()
 						m.gtxtin.Blur()
+						switch m.prompt {
+							case promptName:
+								winInd := getFocWinInd (m)
+								if winInd >= 0 { // if ther is a selected window, set it's name
+									m.windows[winInd].name = val
+									// a name given by hand wins over the program's title,
+									// clearing it hands the window back to the program
+									m.windows[winInd].lockName = val != ""
+								}
+							case promptSave:
+								if val != "" {
+									return m, saveLayout (m, val)
+								}
+							case promptLoad:
+								if val != "" {
+									return m, loadLayout (val)
+								}
+							case promptRec:
+								winInd := getFocWinInd (m)
+								if winInd < 0 || val == "" {
+									break
+								}
+								rec, err := startRec (m.windows[winInd], val)
+								if err != nil {
+									m.note = fmt.Sprintf("couldn't record: %v", err)
+									break
+								}
+								m.windows[winInd].rec = rec
+								m.note = "recording to " + val
+							case promptPlay:
+								if val != "" {
+									return m, loadCast (val)
+								}
+						}
+					} else if m.action != scroll { // scroll mode keeps it from the window like every other key
+						sendKey (m, msg)
+					}
+					return m, nil
+				case "alt+l": // lock the window's name over the program's title, or unlock it
+					winInd := getFocWinInd (m)
+					if winInd >= 0 {
+						w := &m.windows[winInd]
+						if !w.lockName && w.name == "" {
+							w.name = w.term.title // lock in whatever it's called right now
+						}
+						w.lockName = !w.lockName
 					}
 					return m, nil
 				case "alt+1": // toggle ws 1
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b10000000
 					} else {
@@ -398,7 +790,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+2": // toggle ws 2
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b01000000
 					} else {
@@ -406,7 +798,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+3": // toggle ws 3
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00100000
 					} else {
@@ -414,7 +806,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+4": // toggle ws 4
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00010000
 					} else {
@@ -422,7 +814,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+5": // toggle ws 5
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00001000
 					} else {
@@ -430,7 +822,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+6": // toggle ws 6
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00000100
 					} else {
@@ -438,7 +830,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+7": // toggle ws 7
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00000010
 					} else {
@@ -446,13 +838,74 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				case "alt+8": // toggle ws 8
-					winInd := getCurWinInd (m)
+					winInd := getFocWinInd (m)
 					if winInd >= 0 {
 						m.windows[winInd].onWS = m.windows[winInd].onWS^0b00000001
 					} else {
 						m.visWS = m.visWS^0b00000001
 					}
 					return m, nil
+				default: // anything ttywm doesn't use goes to the window
+					if !m.gtxtin.Focused() {
+						winInd := getFocWinInd (m)
+						if m.action == scroll && winInd >= 0 {
+							// scroll mode keeps the keys to itself
+							t := m.windows[winInd].term
+							switch msg.String() {
+								case "up":
+									t.scrollView(1)
+								case "down":
+									t.scrollView(-1)
+								case "pgup":
+									t.scrollView(t.rows)
+								case "pgdown":
+									t.scrollView(-t.rows)
+								case "home":
+									t.scrollView(t.sb.n)
+								case "end":
+									t.scroll = 0
+								case "esc", "q":
+									t.scroll = 0
+									m.action = cursor
+							}
+							return m, nil
+						}
+						if winInd >= 0 && m.windows[winInd].play != nil {
+							return playKey (m, winInd, msg)
+						}
+						if winInd >= 0 && m.windows[winInd].exited {
+							// the process is gone, so the window only takes r and q
+							switch msg.String() {
+								case "r": // respawn
+									w := &m.windows[winInd]
+									old := w.pty
+									cmd, err := spawn (w, w.cmd.Args, w.cmd.Dir)
+									if err != nil {
+										return m, nil
+									}
+									old.Close()
+									return m, cmd
+								case "q": // close
+									w := m.windows[winInd]
+									m.windows = append (m.windows[:winInd], m.windows[winInd+1:]...)
+									refocus (&m)
+									return m, closeWin (w)
+							}
+							return m, nil
+						}
+						sendKey (m, msg)
+						return m, nil
+					}
+			}
+		case fmt.Stringer: // after the other msgs, plenty of them are Stringers too
+			// bubbletea hands over the bracketed paste markers as unknown sequences
+			switch msg.String() {
+				case pasteStart:
+					m.pasting = true
+					m.paste = m.paste[:0]
+					return m, nil
+				case pasteEnd:
+					return m, endPaste (&m)
 			}
 	}
 	var cmd tea.Cmd
@@ -460,26 +913,160 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-// get index of window the cursor is currently over
+// open a new window with a shell in dir at the cursor, an empty dir is ttywm's own
+func newWin (m model, dir string) (model, tea.Cmd) {
+	// create the new window
+	w :=
+		window {
+			id    : m.winCt,
+			name  : "",
+			onWS  : m.visWS,
+			top   : m.currY,
+			lines : 16, // TODO: pull this out into a const DEF_WSZ
+			left  : m.currX,
+			cols  : 65,
+		}
+	// execute bash or whatever shell the user wants
+	cmd, err := spawn (&w, []string {"/bin/bash"}, dir) // TODO: move this to a const SHELL
+	// if the pty doesn't initialize just stop here and don't make a window
+	if err != nil {
+		return m, nil // TODO: actually show the error if it comes up
+	}
+	m.winCt++ // inc winCt to make sure the next window made has a unique id
+	m.windows = append(m.windows, w) // add the window to the top of the stack
+	focusWin (&m, len(m.windows)-1)
+	return m, cmd
+}
+
+// pass a window's new size on to its terminal and its pty, setting the
+// pty size is what sends SIGWINCH to the program running in it
+func resizeWin (w window) {
+	w.term.resize(int(w.lines), int(w.cols))
+	w.rec.resize(w.cols, w.lines)
+	if w.pty == nil {
+		return // playing back a recording
+	}
+	pty.Setsize(w.pty, &pty.Winsize {
+		Rows : w.lines,
+		Cols : w.cols,
+	})
+}
+
+// what a window is called, the program's title unless a name has been locked over it
+func winName (w window) string {
+	if w.lockName || w.term.title == "" {
+		return w.name
+	}
+	return w.term.title
+}
+
+// the directory a window's program is in. whatever the shell last reported
+// with OSC 7 if it does that, otherwise the foreground process's cwd from /proc
+func winCwd (w window) string {
+	if w.term.cwd != "" || w.play != nil {
+		return w.term.cwd
+	}
+	if w.exited {
+		return w.cmd.Dir
+	}
+	dir, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", fgPid (w)))
+	if err != nil {
+		return w.cmd.Dir
+	}
+	return dir
+}
+
+// pid of the process group leader in the foreground of a window's pty,
+// or the window's own process if that can't be had
+func fgPid (w window) int {
+	pid := w.cmd.Process.Pid
+	if sc, err := w.pty.SyscallConn(); err == nil {
+		sc.Control(func (fd uintptr) {
+			if pg, err := unix.IoctlGetInt(int(fd), unix.TIOCGPGRP); err == nil && pg > 0 {
+				pid = pg
+			}
+		})
+	}
+	return pid
+}
+
+// name of the command in the foreground of a window
+func fgCmd (w window) string {
+	switch {
+		case w.play != nil:
+			return "playing " + filepath.Base(w.play.path)
+		case w.exited:
+			return w.stat
+	}
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", fgPid (w)))
+	if err != nil {
+		return w.cmd.Args[0]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// write a key press to the pty of the focused window
+func sendKey (m model, k tea.KeyMsg) {
+	winInd := getFocWinInd (m)
+	if winInd < 0 {
+		return
+	}
+	w := m.windows[winInd]
+	if w.exited || w.play != nil {
+		return
+	}
+	if b := keyBytes (k, w.term.appCur); len(b) > 0 {
+		w.term.scroll = 0 // typing brings the window back to the live screen
+		w.pty.Write(b)
+	}
+}
+
+// get index of window the cursor is currently over, borders and all
 // return -1 if cursor is not over any window
 func getCurWinInd (m model) int {
-	ws := m.windows
-	x := m.currX
-	y := m.currY
-	index := -1
-	for i, w := range ws {
-		if m.visWS&w.onWS > 0 && currWin (x, y, w) {
-			index = i
+	return winAt (m, m.currX, m.currY)
+}
+
+// get index of the focused window, which is what keys and commands go to
+// return -1 if nothing is focused or the focused window isn't visible
+func getFocWinInd (m model) int {
+	if !m.focused {
+		return -1
+	}
+	for i, w := range m.windows {
+		if w.id == m.focus && m.visWS&w.onWS > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// give the window at index i focus, -1 takes focus away from everything
+func focusWin (m *model, i int) {
+	m.focused = i >= 0
+	if i >= 0 {
+		m.focus = m.windows[i].id
+	}
+}
+
+// focus the topmost visible window, for when the focused one goes away
+func refocus (m *model) {
+	for i := len(m.windows)-1; i >= 0; i-- {
+		if m.visWS&m.windows[i].onWS > 0 {
+			focusWin (m, i)
+			return
 		}
 	}
-	return index
+	focusWin (m, -1)
 }
 
-func currWin (x, y int, w window) bool {
-	return x >= w.left &&
-		x <= w.left - 1 + int(w.cols) &&
-		y >= w.top &&
-		y <= w.top - 1 + int(w.lines)
+// with focusFollowsPointer on, whatever window the cursor is over gets focus
+func followPointer (m *model) {
+	if focusFollowsPointer {
+		if i := getCurWinInd (*m); i >= 0 {
+			focusWin (m, i)
+		}
+	}
 }
 
 // ~~~~~
@@ -501,31 +1088,32 @@ func (m model) View() string {
 			finStrs[k + len(finStrs)] = v(m, finStrs[k + len(finStrs)])
 		}
 	}
-	// draw windows
+	// turn it all into cells so windows can be drawn over it with their colors
+	scr := newScreen (m.width, m.height, finStrs)
+	// draw windows, from the bottom of the stack up so the top one ends up on top
 	for _, w := range m.windows {
 		if m.visWS&w.onWS > 0 {
-			finStrs = drawWin(finStrs, w)
+			drawWin(scr, w, m.focused && w.id == m.focus)
 		}
 	}
+	if m.switcher {
+		drawSwitcher (scr, m)
+	}
 	// draw the cursor on top
-	for k, v := range finStrs {
-		if k == m.currY {
-			nstr := ""
-			for i, r := range v {
-				if i == m.currX {
-					nstr += "🠭" // TODO pullthis into a const CURSOR_RUNE
-				} else {
-					nstr += fmt.Sprintf("%c", r)
-				}
-			}
-			finStrs[k] = nstr
-		}
+	scr.putStr(m.currX, m.currY, cursorGlyph)
+	// ask about the clipboard in the bottom right, or tell the user whatever there is to tell
+	if len(m.clipAsks) > 0 && len(scr) > 0 {
+		cp := clipPrompt (m)
+		scr.putStr(m.width-strWidth (cp), len(scr)-1, cp)
+	} else if m.note != "" && len(scr) > 0 {
+		scr.putStr(m.width-strWidth (m.note), len(scr)-1, m.note)
 	}
+	finStrs = scr.render()
 	// if gtxtin is focused, render it
-	if m.gtxtin.Focused() {
-		ln := 27 // this is m.gtxtin.Width + len(m.gtxtin.Prompt) (default "> " so two)
-		lst := len(finStrs) - 1
-		finStrs[lst] = finStrs[lst][:len(finStrs[lst])-ln] + m.gtxtin.View()
+	if m.gtxtin.Focused() && len(scr) > 0 {
+		ln := m.gtxtin.Width + strWidth (m.gtxtin.Prompt)
+		lst := len(scr) - 1
+		finStrs[lst] = renderCells (scr[lst][:max(len(scr[lst])-ln, 0)]) + m.gtxtin.View()
 	}
 	// return the final product
 	return strings.Join(finStrs, "\n")
@@ -536,7 +1124,8 @@ func fillBG(m model) []string {
 	fulStrs := make([] string, 0)
 	// first stretch all lines to the m.width
 	for _, str := range allBGs[m.bg] {
-		fulStrs = append(fulStrs, strings.Repeat(str, m.width/len(str)) + str[0:m.width%len(str)])
+		sw := strWidth (str) // go by columns, a wallpaper can have wide or multibyte runes in it
+		fulStrs = append(fulStrs, strings.Repeat(str, m.width/sw) + cutCols (str, 0, m.width%sw))
 	}// append the lines until less than one more set can fit
 	// TODO, figure out why: for i:=2; i*len(allBGs[m.bg])<=m.height; i++ started eating ram like crazy
 
@@ -550,139 +1139,125 @@ func fillBG(m model) []string {
 	return finStrs
 }
 
-/*
-TODO: rewrite to work more better and stuff
-drawWin :: [String] -> Window -> Int -> [String]
-drawWin wrkspc win wid
-drawWin should take a list of Strings representing the screen before, and a Window
-to be drawn on it.  Height is not needed as it's just len(wrkspc), width is not
-needed as I plan to not allow a window to move off screen to the left or right----
--nvm that doesn't solve the problem of rendering one window on top of another so
-I should just deal with this problem instead of trying to avoid it
-
-Note:
-	Window.top == line to render top border of window
-	Window.lines == how many lines to give the window
-	Window.left == column to render left border of window
-	Window.cols == number of columns to give the window
-sudocode of logit to implement:
-if win.top >= len(wrkspc) ||
-	 win.left >= wid ||
-	 win.top + win.lines + 1 < 0 ||
-	 win.left + win.cols + 1 < 0 then
-		 window is fully out of frame do not render
-else if
-*/
-
-func drawWin (strs []string, w window) []string {
+// draw a window and its border onto the screen. the window's top left
+// border corner goes at w.left, w.top and its contents inside of that,
+// whatever hangs off any edge of the screen is clipped. foc highlights the border
+func drawWin (scr screen, w window, foc bool) {
 	intlines := int(w.lines) // for
 	intcols := int(w.cols) // convenience
+	if w.top >= len(scr) || w.top+intlines+1 < 0 ||
+		len(scr) == 0 || w.left >= len(scr[0]) || w.left+intcols+1 < 0 {
+		return // window is fully out of frame, nothing to draw
+	}
 	// draw top border
-	strs[w.top] = strs[w.top][:w.left] +
-		"╭" + strings.Repeat("─", int(intcols)) + "╮" +
-		strs[w.top][w.left+int(intcols)+2:]
+	lbl := winName (w)
+	if w.term.scroll > 0 { // show how far back in the scrollback the window is
+		lbl += fmt.Sprintf(" [%d/%d]", w.term.scroll, w.term.sb.n)
+	}
+	if w.rec != nil {
+		lbl += " [rec]"
+	}
+	topBdr := strings.Repeat("─", intcols)
+	if lbl != "" {
+		topBdr = borderLabel (intcols, strings.TrimSpace(lbl))
+	}
+	scr.putStr(w.left, w.top, "╭" + topBdr + "╮")
+	bdr := cell { rn: '│' }
+	if foc { // the focused window's border stands out
+		bdr.fg = focusColor
+		bdr.attr = attrBold
+	}
+	if w.flash {
+		bdr.attr |= attrReverse
+	}
 	// draw lines
-	ltc := 14
 	for i:=0; i<intlines; i++ {
-		//msg := fmt.Sprintf("there are %d lines of cont of len %d", len(w.cont), len(w.cont[0]))
-		msg := ""
-		if ltc < len(w.cont){
-			lir := []rune(w.cont[ltc])
-			switch i {
-				case 0: msg = "checking line " + fmt.Sprint(ltc)
-				case 1: msg = w.cont[ltc]
-				case 2: msg = "length in bytes: " + fmt.Sprint(len(w.cont[ltc]))
-				case 3: msg = "length in runes: "+ fmt.Sprint(len(lir))
-				case 4: msg = "number of graphic: "+ fmt.Sprint(countRunesAre(lir, unicode.IsGraphic))
-				case 5: msg = "number of print: "+ fmt.Sprint(countRunesAre(lir, unicode.IsPrint))
-				case 6: msg = "number of control: "+ fmt.Sprint(countRunesAre(lir, unicode.IsControl))
-				case 7: msg = "number of control ext: "+ fmt.Sprint(countRunesAre(lir, altIsControl))
-				case 8: msg = "number of control format: "+ fmt.Sprint(countRunesAre(lir, isControlFmt))
-				case 9: msg = "number of letters: "+ fmt.Sprint(countRunesAre(lir, unicode.IsLetter))
-				case 10: msg = "number of digits: "+ fmt.Sprint(countRunesAre(lir, unicode.IsDigit))
-				case 11: msg = "number of punctuation: "+ fmt.Sprint(countRunesAre(lir, unicode.IsPunct))
-				case 12: msg = "number of space: "+ fmt.Sprint(countRunesAre(lir, unicode.IsSpace))
-				case 13: msg = "number of symbol: "+ fmt.Sprint(countRunesAre(lir, unicode.IsSymbol))
-				case 14: msg = "number of number: "+ fmt.Sprint(countRunesAre(lir, unicode.IsNumber))
-			}
+		y := w.top+i+1
+		if y < 0 || y >= len(scr) {
+			continue
 		}
-// 		if i < len(w.cont) {
-// 			// msg = w.cont[i]
-// 			msg = fmt.Sprintf("%d", len([]rune(w.cont[i])))
-// 		}
-		if lnmsg := len(msg); lnmsg < intcols {
-			msg += strings.Repeat(" ", intcols - lnmsg)
+		scr.set(w.left, y, bdr)
+		for x:=0; x<intcols; x++ {
+			c := blankCell
+			if i < w.term.rows {
+				if l := w.term.viewLine(i); x < len(l.cells) {
+					c = l.cells[x]
+				}
+				if w.term.showCur && w.term.scroll == 0 && i == w.term.curY && x == w.term.curX {
+					c.attr ^= attrReverse // show the window's cursor
+				}
+			}
+			scr.set(w.left+1+x, y, c)
 		}
-		strs[w.top+i+1] = strs[w.top+i+1][:w.left] +
-			"│" + msg + "│" +// why is this doing the wrong thing is it stupid ??????
-			strs[w.top+i+1][w.left+intcols+2:]
+		scr.set(w.left+intcols+1, y, bdr)
 	}
-	strs[w.top+intlines+1] = strs[w.top+intlines+1][:w.left] +
-		"╰" + strings.Repeat("─", intcols) + "╯" +
-		strs[w.top+intlines+1][w.left+intcols+2:]
-	return strs
-}
-
-func countRunesAre (rs []rune, fn func (rune) bool) int {
-	counter := 0
-	for _, r := range rs {
-		if fn (r){
-			counter++
+	bot := strings.Repeat("─", intcols)
+	switch {
+		case w.exited: // let the user know the process is gone and what they can do
+			bot = borderLabel (intcols, w.stat + " r:respawn q:close")
+		case w.play != nil:
+			bot = borderLabel (intcols, playLabel (w.play))
+	}
+	scr.putStr(w.left, w.top+intlines+1, "╰" + bot + "╯")
+	// the top and bottom borders get the sides' style too
+	for _, y := range []int { w.top, w.top+intlines+1 } {
+		for x := w.left; x <= w.left+intcols+1; x++ {
+			if y >= 0 && y < len(scr) && x >= 0 && x < len(scr[y]) {
+				scr[y][x].fg = bdr.fg
+				scr[y][x].attr |= bdr.attr
+			}
 		}
 	}
-	return counter
 }
 
-func altIsControl (r rune) bool {
-	return unicode.Is(unicode.C, r)
-}
-func isControlFmt (r rune) bool {
-	return unicode.Is(unicode.Cf, r)
-}
-
-/*
-func drawWin (strs []string, w window) []string {
-	for i, v := range strs {
-		if i == w.top || i == w.top - 1 + w.lines { // draw top and bottom borders
-			nstr := ""
-			for ii, _ := range v {
-				if ii == w.left || ii == w.left + w.cols - 1 {
-					nstr += "+" // TODO: extract into const, termCorner
-				}else if ii > w.left && ii < w.left + w.cols - 1 {
-					nstr += "-" // TODO: extract into const, termTopBotBorder
-				} else {
-					nstr += fmt.Sprintf("%c", v[ii])
-				}
-			}
-			strs[i] = nstr // v[:w.left] + "+" + strings.Repeat("-", w.cols-2) + "+" + v[w.left + w.cols:]
-		}
-		if i > w.top && i < w.top - 1 + w.lines { // draw contents
-			nstr := ""
-			// ln := i - w.top - 1 // index of w.cont to render
-			for ii, _ := range v {
-				if ii == w.left || ii == w.left + w.cols - 1 {
-					nstr += "|" // TODO: extract into const, termLftRgtCorner
-				} else if ii > w.left && ii < w.left + w.cols - 1 {
-					// rn := ii - w.left - 1 // index of rune to print
-					nstr += " " // string(w.cont[ln][rn])
-				} else {
-					nstr += fmt.Sprintf("%c", v[ii])
-				}
-			}
-			strs[i] = nstr // v[:w.left] + "|" + strings.Repeat(" ", w.cols-2) + "|" + v[w.left + w.cols:]
-		}
+// a horizontal border n runes long with lbl set into it, lbl gets cut short if it doesn't fit
+func borderLabel (n int, lbl string) string {
+	lbl = "─ " + lbl + " "
+	if lw := strWidth (lbl); lw < n {
+		return lbl + strings.Repeat("─", n-lw)
 	}
-	return strs
+	return cutCols (lbl, 0, n)
 }
-*/
 
 // ~~~~~
 // main
 // ~~~~~
 
 func main() {
-    p := tea.NewProgram(initialModel())
-    if _, err := p.Run(); err != nil {
+    layout := flag.String("layout", "", "layout file to open windows from at startup")
+    session := flag.String("session", "", "attach to a detachable session, starting it if it isn't running")
+    attachTo := flag.String("attach", "", "attach to a detachable session that's already running")
+    ls := flag.Bool("ls", false, "list the running sessions")
+    serveName := flag.String("serve", "", "run the server for a session in the foreground, -session starts one for you")
+    readOnly := flag.Bool("readonly", false, "attach without being able to type into the session")
+    vpFlag := flag.Bool("viewport", false, "size a new session to its biggest client, smaller ones see a piece of it")
+    flag.Parse()
+    if *vpFlag {
+        clientSize = sizeViewport
+    }
+    m := initialModel()
+    m.layout = *layout
+    var err error
+    switch {
+        case *ls:
+            err = listSessions()
+        case *serveName != "":
+            err = serve (*serveName, m)
+        case *attachTo != "":
+            err = attach (*attachTo, *readOnly)
+        case *session != "":
+            if !running (*session) {
+                err = startServer (*session, *layout, clientSize)
+            }
+            if err == nil {
+                err = attach (*session, *readOnly)
+            }
+        default: // no session, everything goes away with this terminal
+            p := tea.NewProgram(m, tea.WithMouseAllMotion())
+            _, err = p.Run()
+            hostPaste (false)()
+    }
+    if err != nil {
         fmt.Printf("Alas, there's been an error: %v", err)
         os.Exit(1)
     }
@@ -692,6 +1267,79 @@ func main() {
 // config vars
 //~~~~~~~~~~~~~
 
+// reported to programs that ask the terminal what it is (XTVERSION)
+const version = "0.1"
+
+// most times a second the screen gets redrawn for pty output
+const maxFPS = 60
+
+// how many bytes get read from a pty at once, and how many of those chunks
+// can be waiting on the ui before the reader stops reading
+const (
+	readSize   = 32 * 1024
+	ptyBacklog = 16
+)
+
+// what picking a window on a hidden workspace in the alt+tab switcher does,
+// switchShowWS changes visWS and switchBringWin changes the window's onWS
+var switchTo = switchShowWS
+
+// whether the window under the cursor gets focus just by being pointed at,
+// rather than by clicking it or alt+f
+var focusFollowsPointer = false
+
+// color of the focused window's border
+var focusColor = colIndexed | 12
+
+// how a session is sized when its clients' terminals are different sizes
+var clientSize = sizeSmallest
+
+// where window recordings go unless another file is given
+var recordDir = os.TempDir()
+
+// how far left and right seek in a recording being played back, and the
+// longest a playback sits waiting on nothing
+var seekStep = 5 * time.Second
+var castIdleMax = 2 * time.Second
+
+// what detaches a client from a session, alt+x
+var detachKey = "\x1bx"
+
+// how many rows a turn of the mouse wheel scrolls a window
+var wheelLines = 3
+
+// what gets drawn at the cursor's position
+var cursorGlyph = "🠭"
+
+// the most rows or columns a window opened from a file can have, so a
+// broken layout or cast can't ask for billions of cells
+const maxWinSize = 1000
+
+// how many rows of scrollback each window keeps
+var scrollbackLen = 2000
+
+// what happens to a window when the program in it exits
+var closeOnExit = closeClean
+
+// how a bell shows up, how long a visual bell flashes for, and whether
+// bells get passed on to the host terminal too
+var bellMode = bellVisual
+var bellFlash = 150 * time.Millisecond
+var bellForward = false
+
+// how long a closed window's process gets after SIGHUP before it's killed
+var killTimeout = 3 * time.Second
+
+// whether programs can set (write) and get (read) the clipboard with OSC 52
+var clipWrite = clipAllow
+var clipRead = clipAsk
+
+// which clipboard they get
+var clipTarget = clipHost
+
+// where OSC 52 for the host terminal's clipboard gets written
+var hostOut io.Writer = os.Stdout
+
 var allBGs = [][]string {
 	{
 		"/|/ \\|\\ ",
@@ -715,31 +1363,44 @@ var barFns = map[int]func(model, string) string {
 				"[", m.width, " x ", m.height, "]",
 				"[", strAct(m.action), "]",
 			)
-			wd += s[len(wd):]
+			var urg []string
+			for _, w := range m.windows { // even ones on hidden workspaces
+				if w.urgent {
+					urg = append(urg, fmt.Sprint(w.id))
+				}
+			}
+			if len(urg) > 0 {
+				wd += "[urgent: " + strings.Join(urg, " ") + "]"
+			}
+			wd = overlayStr (s, 0, wd)
 			hour, min, sec := m.dt.Clock()
 			hms := stringTime (hour, min, sec)
 			// making two changes to wd means hms could overwrite wd
 			// but also avoids crash if total length is too long
-			wd = wd[:len(wd)-len(hms)] + hms
+			wd = overlayStr (wd, strWidth (wd)-strWidth (hms), hms)
 			return wd
 		},
 	1:
 		func (m model, s string) string {
 			visWS := fmt.Sprintf("visWS: %08b", m.visWS)
-			fin := visWS + s[len(visWS):]
+			fin := overlayStr (s, 0, visWS)
 			curWin := ""
-			curWinInd := getCurWinInd (m)
+			curWinInd := getFocWinInd (m)
 			if curWinInd >= 0 {
 				win := m.windows[curWinInd]
-				curWin = fmt.Sprintf("n:%s|id:%d|on:%08b", win.name, win.id, win.onWS)
+				nm := winName (win)
+				if win.lockName {
+					nm += "[L]"
+				}
+				curWin = fmt.Sprintf("n:%s|id:%d|on:%08b", nm, win.id, win.onWS)
 			} else {
 				curWin = "no window selected"
 			}
-			fin = fin[:len(fin)-len(curWin)] + curWin
+			fin = overlayStr (fin, strWidth (fin)-strWidth (curWin), curWin)
 			return fin
 		},
 	-1:
-		func (_ model, s string) string {
+		func (m model, s string) string {
 			fin := ""
 			cmd := exec.Command("uptime", "-p")
 			var out strings.Builder
@@ -750,7 +1411,14 @@ var barFns = map[int]func(model, string) string {
 			} else {
 				fin = strings.TrimSpace(out.String())
 			}
-			fin += s[len(fin):]
+			fin = overlayStr (s, 0, fin)
+			if cw := getFocWinInd (m); cw >= 0 {
+				dir := winCwd (m.windows[cw])
+				if home, err := os.UserHomeDir(); err == nil && home != "/" && strings.HasPrefix(dir+"/", home+"/") {
+					dir = "~" + dir[len(home):]
+				}
+				fin = overlayStr (fin, strWidth (fin)-strWidth (dir), dir)
+			}
 			return fin
 		},
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUtf8Boundary (t *testing.T) {
+	// every way a rune of each length can get cut off at the end of a read
+	for _, r := range []string { "é", "世", "💻" } {
+		for k := 0; k <= len(r); k++ {
+			b := []byte("ab" + r[:k])
+			want := len(b)
+			if k > 0 && k < len(r) {
+				want = 2 // the partial rune waits for the next read
+			}
+			if got := utf8Boundary (b); got != want {
+				t.Errorf("%q cut to %d bytes: got %d, want %d", r, k, got, want)
+			}
+		}
+	}
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abc", 3},
+		{"only a partial rune", "\xe4\xb8", 0},
+		{"whole runes", "é世💻", 9},
+		{"stray continuation byte", "ab\x80", 3},
+		{"three continuation bytes", "ab\x80\x80\x80", 5},
+		{"invalid lead byte", "ab\xff", 3},
+		{"lead byte that can't start a rune", "ab\xc0", 3},
+		{"overlong start", "ab\xe0\x80", 4},
+		{"surrogate start", "ab\xed\xa0", 4},
+		{"past the last rune", "ab\xf4\x90", 4},
+		{"partial after a whole one", "世\xf0\x9f\x92", 3},
+	}
+	for _, tc := range tests {
+		if got := utf8Boundary ([]byte(tc.in)); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}